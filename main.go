@@ -1,8 +1,18 @@
 package main
 
 import (
+	"ambassador/src/analytics"
+	"ambassador/src/checkouts"
 	"ambassador/src/database"
+	"ambassador/src/exports"
+	"ambassador/src/links"
+	"ambassador/src/mailer"
+	"ambassador/src/outbox"
+	"ambassador/src/rankings"
+	"ambassador/src/realtime"
 	"ambassador/src/routes"
+	"ambassador/src/scheduler"
+	"ambassador/src/webhooks"
 	"context"
 	"github.com/gofiber/fiber/v2"
 	"github.com/gofiber/fiber/v2/middleware/cors"
@@ -20,6 +30,29 @@ func main() {
 	database.SetupRedis()
 	database.SetupCacheChannel()
 
+	// Receive dashboard events published by every API instance
+	realtime.Setup()
+
+	// Start the batched analytics event writer
+	analytics.Setup()
+
+	// Start the email delivery queue
+	mailer.Setup()
+
+	// Export jobs do not survive a restart of the instance running them
+	exports.Setup()
+
+	// Periodically reconcile the leaderboards with the database, expire
+	// checkouts that were never paid, tell ambassadors about expired links
+	// and fail export jobs whose instance went away
+	scheduler.Start(rankings.RebuildJob, checkouts.ExpiryJob, links.ExpiryJob, exports.StaleJob)
+
+	// Carry out side effects recorded in the outbox
+	outbox.StartDispatcher()
+
+	// Send webhook deliveries to subscribed endpoints
+	webhooks.StartDispatcher()
+
 	// Create a new Fiber app
 	app := fiber.New()
 
@@ -28,7 +61,7 @@ func main() {
 		AllowCredentials: true,
 		AllowOrigins:     "http://localhost:3000, http://localhost:4000, http://localhost:5000",
 		AllowMethods:     "GET,POST,PUT,DELETE,OPTIONS",
-		AllowHeaders:     "Origin, Content-Type, Accept, Authorization",
+		AllowHeaders:     "Origin, Content-Type, Accept, Authorization, Idempotency-Key, Last-Event-ID",
 	}))
 
 	// Set up routes
@@ -53,11 +86,21 @@ func main() {
 	_, cancel := context.WithTimeout(context.Background(), 10*time.Second)
 	defer cancel()
 
+	// End open event streams, which would otherwise keep the server from stopping
+	realtime.Close()
+
 	// Shutdown the Fiber server
 	if err := app.Shutdown(); err != nil {
 		log.Printf("Error shutting down server: %v", err)
 	}
 
+	// Stop background jobs and flush pending analytics events before the database goes away
+	scheduler.Stop()
+	outbox.StopDispatcher()
+	webhooks.StopDispatcher()
+	analytics.Close()
+	mailer.Close()
+
 	// Close the database connection
 	sqlDB, err := database.DB.DB()
 	if err != nil {
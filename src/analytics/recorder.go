@@ -0,0 +1,145 @@
+package analytics
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"context"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"sync"
+	"time"
+)
+
+const (
+	bufferSize    = 1024
+	batchSize     = 100
+	flushInterval = 2 * time.Second
+
+	// visitWindow is how long repeated visits by the same visitor count as one click.
+	visitWindow = 30 * time.Minute
+)
+
+var (
+	events chan models.LinkEvent
+	done   sync.WaitGroup
+
+	// mu guards closed so no event is sent after the channel is closed
+	mu     sync.RWMutex
+	closed bool
+)
+
+// Setup starts the background writer that stores events in batches.
+func Setup() {
+	events = make(chan models.LinkEvent, bufferSize)
+
+	done.Add(1)
+	go func() {
+		defer done.Done()
+
+		ticker := time.NewTicker(flushInterval)
+		defer ticker.Stop()
+
+		batch := make([]models.LinkEvent, 0, batchSize)
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					flush(batch)
+					return
+				}
+				batch = append(batch, event)
+				if len(batch) >= batchSize {
+					batch = flush(batch)
+				}
+			case <-ticker.C:
+				batch = flush(batch)
+			}
+		}
+	}()
+}
+
+// Close stops accepting events and waits for the pending batch to be written.
+func Close() {
+	if events == nil {
+		return
+	}
+
+	mu.Lock()
+	if closed {
+		mu.Unlock()
+		return
+	}
+	closed = true
+	close(events)
+	mu.Unlock()
+
+	done.Wait()
+	log.Println("Analytics events flushed")
+}
+
+// Record queues an event without blocking the request. Events are dropped
+// when the buffer is full rather than slowing down checkout, and after Close.
+func Record(event models.LinkEvent) {
+	if events == nil {
+		return
+	}
+	if event.CreatedAt.IsZero() {
+		event.CreatedAt = time.Now()
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	if closed {
+		return
+	}
+
+	select {
+	case events <- event:
+	default:
+		log.Printf("Analytics buffer full, dropping %s event for link %s", event.Type, event.Code)
+	}
+}
+
+// RecordVisit records a click unless the same visitor already clicked the
+// link within the visit window. Pass the fingerprint of visitors who came
+// without a visitor cookie: their click counts only when neither the newly
+// issued visitor ID nor the fingerprint was seen, so clients that drop
+// cookies are not counted on every request.
+func RecordVisit(event models.LinkEvent, fingerprint string) {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	// Claim both keys, so return visits are recognised by either
+	pipe := database.Cache.Pipeline()
+	visitor := pipe.SetNX(ctx, "link_visit:"+event.Code+":"+event.VisitorId, 1, visitWindow)
+	var seen *redis.BoolCmd
+	if fingerprint != "" {
+		seen = pipe.SetNX(ctx, "link_visit:"+event.Code+":"+fingerprint, 1, visitWindow)
+	}
+
+	isNew := true
+	if _, err := pipe.Exec(ctx); err != nil {
+		// Prefer over-counting to losing the click when Redis is unavailable
+		log.Printf("Failed to deduplicate visit: %v", err)
+	} else {
+		isNew = visitor.Val() && (seen == nil || seen.Val())
+	}
+
+	if isNew {
+		event.Type = models.EventClick
+		Record(event)
+	}
+}
+
+// flush writes the batch and returns it emptied for reuse.
+func flush(batch []models.LinkEvent) []models.LinkEvent {
+	if len(batch) == 0 {
+		return batch
+	}
+
+	if err := database.DB.CreateInBatches(batch, batchSize).Error; err != nil {
+		log.Printf("Failed to store %d analytics events: %v", len(batch), err)
+	}
+
+	return batch[:0]
+}
@@ -0,0 +1,96 @@
+package analytics
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"time"
+)
+
+// FunnelPoint holds funnel counts for one link on one day.
+type FunnelPoint struct {
+	Date      string `json:"date"`
+	Clicks    int64  `json:"clicks"`
+	Checkouts int64  `json:"checkouts"`
+	Orders    int64  `json:"orders"`
+}
+
+// LinkFunnel summarizes the conversion funnel of a link over a date range.
+type LinkFunnel struct {
+	Code           string        `json:"code"`
+	Clicks         int64         `json:"clicks"`
+	Checkouts      int64         `json:"checkouts"`
+	Orders         int64         `json:"orders"`
+	CheckoutRate   float64       `json:"checkout_rate"`
+	ConversionRate float64       `json:"conversion_rate"`
+	Series         []FunnelPoint `json:"series"`
+}
+
+// Funnel aggregates link events between from (inclusive) and to (exclusive)
+// per link and day. When codes is nil every link is included.
+func Funnel(codes []string, from time.Time, to time.Time) ([]LinkFunnel, error) {
+	type row struct {
+		Code      string
+		Day       time.Time
+		Clicks    int64
+		Checkouts int64
+		Orders    int64
+	}
+
+	query := database.DB.Model(&models.LinkEvent{}).
+		Select(`code, DATE(created_at) AS day,
+			SUM(CASE WHEN type = ? THEN 1 ELSE 0 END) AS clicks,
+			SUM(CASE WHEN type = ? THEN 1 ELSE 0 END) AS checkouts,
+			SUM(CASE WHEN type = ? THEN 1 ELSE 0 END) AS orders`,
+			models.EventClick, models.EventCheckout, models.EventOrder).
+		Where("created_at >= ? AND created_at < ?", from, to).
+		Group("code, DATE(created_at)").
+		Order("code, day")
+
+	if codes != nil {
+		query = query.Where("code IN ?", codes)
+	}
+
+	var rows []row
+	if err := query.Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	// Fold the daily rows into one summary per link, keeping the first-seen order
+	funnels := make([]LinkFunnel, 0)
+	index := make(map[string]int)
+
+	for _, r := range rows {
+		i, ok := index[r.Code]
+		if !ok {
+			i = len(funnels)
+			index[r.Code] = i
+			funnels = append(funnels, LinkFunnel{Code: r.Code, Series: []FunnelPoint{}})
+		}
+
+		funnel := &funnels[i]
+		funnel.Clicks += r.Clicks
+		funnel.Checkouts += r.Checkouts
+		funnel.Orders += r.Orders
+		funnel.Series = append(funnel.Series, FunnelPoint{
+			Date:      r.Day.Format("2006-01-02"),
+			Clicks:    r.Clicks,
+			Checkouts: r.Checkouts,
+			Orders:    r.Orders,
+		})
+	}
+
+	for i := range funnels {
+		funnels[i].CheckoutRate = rate(funnels[i].Checkouts, funnels[i].Clicks)
+		funnels[i].ConversionRate = rate(funnels[i].Orders, funnels[i].Clicks)
+	}
+
+	return funnels, nil
+}
+
+// rate returns part/whole, or zero when there is nothing to divide by.
+func rate(part int64, whole int64) float64 {
+	if whole == 0 {
+		return 0
+	}
+	return float64(part) / float64(whole)
+}
@@ -0,0 +1,229 @@
+package analytics
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Supported bucket sizes for order statistics.
+const (
+	GranularityDay   = "day"
+	GranularityWeek  = "week"
+	GranularityMonth = "month"
+)
+
+// periodFormats maps a granularity to the MySQL format of its bucket key.
+// Week keys use ISO years and weeks to match time.ISOWeek.
+var periodFormats = map[string]string{
+	GranularityDay:   "%Y-%m-%d",
+	GranularityWeek:  "%x-W%v",
+	GranularityMonth: "%Y-%m",
+}
+
+// MaxPeriods bounds the number of buckets in a series, which is a leap year
+// of days, so a long range must use a coarser granularity.
+const MaxPeriods = 366
+
+var ErrTooManyPeriods = fmt.Errorf("date range spans more than %d periods, use a shorter range or a coarser granularity", MaxPeriods)
+
+// ValidGranularity reports whether g is a supported bucket size.
+func ValidGranularity(g string) bool {
+	_, ok := periodFormats[g]
+	return ok
+}
+
+// SalesTotals holds completed order figures for a link. Amounts are in the
+// reporting currency unless stated otherwise.
+type SalesTotals struct {
+	Orders     int64   `json:"orders"`
+	Revenue    float64 `json:"revenue"`
+	Commission float64 `json:"commission"`
+}
+
+// SalesPoint holds the totals of one bucket.
+type SalesPoint struct {
+	Period string `json:"period"`
+	SalesTotals
+}
+
+// Sales aggregates completed orders per link code and bucket between from
+// (inclusive) and to (exclusive). Every bucket of the range is present in the
+// returned series, including empty ones.
+func Sales(codes []string, from time.Time, to time.Time, granularity string) (map[string][]SalesPoint, error) {
+	if err := CheckPeriods(from, to, granularity); err != nil {
+		return nil, err
+	}
+
+	type row struct {
+		Code   string
+		Period string
+		SalesTotals
+	}
+
+	var rows []row
+	err := completedOrders(codes, from, to).
+		Select(fmt.Sprintf("o.code, DATE_FORMAT(o.completed_at, '%s') AS period, %s", periodFormats[granularity], totalsColumns)).
+		Group("o.code, period").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	// Index the rows so empty buckets can be filled in
+	found := make(map[string]map[string]SalesTotals)
+	for _, r := range rows {
+		if found[r.Code] == nil {
+			found[r.Code] = make(map[string]SalesTotals)
+		}
+		found[r.Code][r.Period] = r.SalesTotals
+	}
+
+	periods := Periods(from, to, granularity)
+	series := make(map[string][]SalesPoint, len(codes))
+	for _, code := range codes {
+		points := make([]SalesPoint, len(periods))
+		for i, period := range periods {
+			points[i] = SalesPoint{Period: period, SalesTotals: found[code][period]}
+		}
+		series[code] = points
+	}
+
+	return series, nil
+}
+
+// SalesTotalsByCode aggregates completed orders per link code between from
+// (inclusive) and to (exclusive).
+func SalesTotalsByCode(codes []string, from time.Time, to time.Time) (map[string]SalesTotals, error) {
+	type row struct {
+		Code string
+		SalesTotals
+	}
+
+	var rows []row
+	err := completedOrders(codes, from, to).
+		Select("o.code, " + totalsColumns).
+		Group("o.code").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string]SalesTotals, len(rows))
+	for _, r := range rows {
+		totals[r.Code] = r.SalesTotals
+	}
+
+	return totals, nil
+}
+
+// CurrencyTotals holds completed order figures in one order currency.
+type CurrencyTotals struct {
+	Currency string `json:"currency"`
+	SalesTotals
+}
+
+// SalesTotalsByCurrency aggregates completed orders per link code and order
+// currency between from (inclusive) and to (exclusive), without conversion.
+func SalesTotalsByCurrency(codes []string, from time.Time, to time.Time) (map[string][]CurrencyTotals, error) {
+	type row struct {
+		Code string
+		CurrencyTotals
+	}
+
+	var rows []row
+	err := completedOrders(codes, from, to).
+		Select("o.code, o.currency, " + orderCurrencyColumns).
+		Group("o.code, o.currency").
+		Order("o.currency").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[string][]CurrencyTotals)
+	for _, r := range rows {
+		totals[r.Code] = append(totals[r.Code], r.CurrencyTotals)
+	}
+
+	return totals, nil
+}
+
+// totalsColumns converts every order into the reporting currency at the rate
+// fixed when it was placed.
+const totalsColumns = `COUNT(DISTINCT o.id) AS orders,
+	COALESCE(SUM((oi.price * oi.quantity - oi.discount) * (oi.quantity - oi.refunded_quantity) / oi.quantity * o.reporting_rate), 0) AS revenue,
+	COALESCE(SUM(oi.ambassador_revenue * o.reporting_rate), 0) AS commission`
+
+const orderCurrencyColumns = `COUNT(DISTINCT o.id) AS orders,
+	COALESCE(SUM((oi.price * oi.quantity - oi.discount) * (oi.quantity - oi.refunded_quantity) / oi.quantity), 0) AS revenue,
+	COALESCE(SUM(oi.ambassador_revenue), 0) AS commission`
+
+// completedOrders joins revenue-generating orders of the given links to their items.
+func completedOrders(codes []string, from time.Time, to time.Time) *gorm.DB {
+	return database.DB.Table("orders AS o").
+		Joins("LEFT JOIN order_items oi ON oi.order_id = o.id").
+		Where("o.code IN ? AND o.status IN ?", codes, models.RevenueStatuses).
+		Where("o.completed_at >= ? AND o.completed_at < ?", from, to)
+}
+
+// Periods lists the bucket keys covering from (inclusive) to to (exclusive).
+func Periods(from time.Time, to time.Time, granularity string) []string {
+	periods := make([]string, 0)
+
+	for t := startOfPeriod(from, granularity); t.Before(to); t = nextPeriod(t, granularity) {
+		periods = append(periods, periodKey(t, granularity))
+	}
+
+	return periods
+}
+
+// CheckPeriods returns ErrTooManyPeriods when the range between from and to
+// has more than MaxPeriods buckets of the granularity.
+func CheckPeriods(from time.Time, to time.Time, granularity string) error {
+	count := 0
+	for t := startOfPeriod(from, granularity); t.Before(to); t = nextPeriod(t, granularity) {
+		if count++; count > MaxPeriods {
+			return ErrTooManyPeriods
+		}
+	}
+	return nil
+}
+
+func startOfPeriod(t time.Time, granularity string) time.Time {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	switch granularity {
+	case GranularityWeek:
+		// ISO weeks start on Monday
+		offset := (int(day.Weekday()) + 6) % 7
+		return day.AddDate(0, 0, -offset)
+	case GranularityMonth:
+		return time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+	}
+
+	return day
+}
+
+func nextPeriod(t time.Time, granularity string) time.Time {
+	switch granularity {
+	case GranularityWeek:
+		return t.AddDate(0, 0, 7)
+	case GranularityMonth:
+		return t.AddDate(0, 1, 0)
+	}
+	return t.AddDate(0, 0, 1)
+}
+
+func periodKey(t time.Time, granularity string) string {
+	switch granularity {
+	case GranularityWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case GranularityMonth:
+		return t.Format("2006-01")
+	}
+	return t.Format("2006-01-02")
+}
@@ -0,0 +1,204 @@
+package checkouts
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/mailer"
+	"ambassador/src/models"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/checkout/session"
+	"log"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAge = 24 * time.Hour
+	batchSize  = 100
+)
+
+// ErrPaidUnconfirmed is returned for checkouts that were paid in Stripe but
+// never confirmed. They are left pending and flagged for an admin to review.
+var ErrPaidUnconfirmed = errors.New("checkout was paid but never confirmed")
+
+// abandonable are the statuses of orders whose checkout may be abandoned.
+var abandonable = []string{models.OrderPending, models.OrderFailed}
+
+// Report summarises one expiry run.
+type Report struct {
+	Checked int `json:"checked"`
+	Expired int `json:"expired"`
+	Paid    int `json:"paid_unconfirmed"`
+	Skipped int `json:"skipped"`
+	Errors  int `json:"errors"`
+	Emailed int `json:"emailed"`
+}
+
+// Age returns how old an unpaid checkout must be before it is expired,
+// configured with CHECKOUT_EXPIRY_AGE (e.g. "24h").
+func Age() time.Duration {
+	age, err := time.ParseDuration(os.Getenv("CHECKOUT_EXPIRY_AGE"))
+	if err != nil || age <= 0 {
+		return defaultAge
+	}
+	return age
+}
+
+// RecoveryEnabled reports whether customers are emailed a link to resume an
+// expired checkout, configured with CHECKOUT_RECOVERY_EMAILS=true.
+func RecoveryEnabled() bool {
+	return os.Getenv("CHECKOUT_RECOVERY_EMAILS") == "true"
+}
+
+// URL returns the public checkout page of a link code.
+func URL(code string) string {
+	return BaseURL() + "/" + url.PathEscape(code)
+}
+
+// BaseURL is the checkout frontend, configured with CHECKOUT_URL.
+func BaseURL() string {
+	base := os.Getenv("CHECKOUT_URL")
+	if base == "" {
+		base = "http://localhost:5000"
+	}
+	return strings.TrimRight(base, "/")
+}
+
+// ExpireAbandoned expires every pending or failed order created before
+// olderThan ago. Open Stripe sessions are expired first so they can no longer
+// be paid. Expired orders stop counting towards coupon limits, which releases
+// their redemptions.
+func ExpireAbandoned(ctx context.Context, olderThan time.Duration, sendRecovery bool) (Report, error) {
+	var report Report
+	cutoff := time.Now().Add(-olderThan)
+	lastId := uint(0)
+
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		// Walk the candidates in batches so memory stays bounded
+		var orders []models.Order
+		err := database.DB.Preload("OrderItems").
+			Where("status IN ? AND created_at < ? AND id > ? AND flagged_at IS NULL", abandonable, cutoff, lastId).
+			Order("id").
+			Limit(batchSize).
+			Find(&orders).Error
+		if err != nil {
+			return report, err
+		}
+		if len(orders) == 0 {
+			return report, nil
+		}
+
+		for i := range orders {
+			order := &orders[i]
+			lastId = order.Id
+			report.Checked++
+
+			err := expire(order)
+			var invalid models.ErrInvalidTransition
+			switch {
+			case errors.Is(err, ErrPaidUnconfirmed):
+				// Flag the order once so later runs do not check it again
+				log.Printf("Order %d was paid in Stripe but never confirmed", order.Id)
+				if err := database.DB.Model(order).Update("flagged_at", time.Now()).Error; err != nil {
+					log.Printf("Failed to flag order %d for review: %v", order.Id, err)
+				}
+				report.Paid++
+				continue
+			case errors.As(err, &invalid):
+				// The customer confirmed the order in the meantime
+				report.Skipped++
+				continue
+			case err != nil:
+				log.Printf("Failed to expire order %d: %v", order.Id, err)
+				report.Errors++
+				continue
+			}
+			report.Expired++
+
+			if sendRecovery {
+				if err := sendRecoveryEmail(ctx, *order); err != nil {
+					log.Printf("Failed to send recovery email for order %d: %v", order.Id, err)
+				} else {
+					report.Emailed++
+				}
+			}
+		}
+	}
+}
+
+// expire closes the order's Stripe session if it is still open and marks the
+// order expired.
+func expire(order *models.Order) error {
+	if err := closeSession(order); err != nil {
+		return err
+	}
+	return order.Transition(database.DB, models.OrderExpired, models.ActorSystem, "Checkout abandoned")
+}
+
+// Cancel closes the order's Stripe session if it is still open so it can no
+// longer be paid, and marks the order cancelled. Only unpaid orders can be
+// cancelled; paid ones are refunded instead.
+func Cancel(order *models.Order, actor string, reason string) error {
+	if !order.CanTransition(models.OrderCancelled) {
+		return models.ErrInvalidTransition{From: order.Status, To: models.OrderCancelled}
+	}
+
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+	if err := closeSession(order); err != nil {
+		return err
+	}
+
+	if reason == "" {
+		reason = "Order cancelled"
+	}
+	return order.Transition(database.DB, models.OrderCancelled, actor, reason)
+}
+
+// closeSession expires the order's Stripe checkout session if it is still
+// open, returning ErrPaidUnconfirmed when it was already paid.
+func closeSession(order *models.Order) error {
+	if order.TransactionId != "" {
+		checkout, err := session.Get(order.TransactionId, nil)
+		if err != nil {
+			return fmt.Errorf("fetch checkout session: %w", err)
+		}
+
+		switch checkout.Status {
+		case stripe.CheckoutSessionStatusComplete:
+			return ErrPaidUnconfirmed
+		case stripe.CheckoutSessionStatusOpen:
+			if _, err := session.Expire(order.TransactionId, nil); err != nil {
+				return fmt.Errorf("expire checkout session: %w", err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// sendRecoveryEmail emails the customer a link that restores their cart.
+func sendRecoveryEmail(ctx context.Context, order models.Order) error {
+	if order.Email == "" || len(order.OrderItems) == 0 {
+		return nil
+	}
+
+	token, err := IssueResumeToken(ctx, order.Id)
+	if err != nil {
+		return err
+	}
+
+	return mailer.Notify("checkout_recovery", mailer.LocaleFor(order.Country), []string{order.Email}, map[string]interface{}{
+		"Order": &order,
+		"URL":   URL(order.Code) + "?resume=" + url.QueryEscape(token),
+	})
+}
@@ -0,0 +1,146 @@
+package checkouts
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/mailer"
+	"ambassador/src/models"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// LookupLinkTTL is how long an emailed order link can be opened.
+	LookupLinkTTL = 15 * time.Minute
+	// LookupSessionTTL is how long a customer can view the order once the link is opened.
+	LookupSessionTTL = time.Hour
+
+	lookupRequestLimit  = 5
+	lookupRequestWindow = time.Hour
+)
+
+var (
+	// ErrInvalidLookupToken is returned for unknown, used or expired order links.
+	ErrInvalidLookupToken = errors.New("order link is invalid or has expired")
+	// ErrLookupRateLimited is returned when an email address requested too many links.
+	ErrLookupRateLimited = errors.New("too many order links requested, please try again later")
+)
+
+// AllowLookup counts a link request for an email address and reports
+// whether it is still within the hourly limit.
+func AllowLookup(ctx context.Context, email string) error {
+	key := "order_lookup_requests:" + strings.ToLower(email)
+
+	count, err := database.Cache.Incr(ctx, key).Result()
+	if err != nil {
+		return err
+	}
+	if count == 1 {
+		database.Cache.Expire(ctx, key, lookupRequestWindow)
+	}
+	if count > lookupRequestLimit {
+		return ErrLookupRateLimited
+	}
+	return nil
+}
+
+// SendLookupLink emails the customer of an order a one-time link to view it.
+func SendLookupLink(ctx context.Context, order models.Order) error {
+	token, err := randomToken()
+	if err != nil {
+		return err
+	}
+
+	if err := database.Cache.Set(ctx, lookupKey(token), order.Id, LookupLinkTTL).Err(); err != nil {
+		return err
+	}
+
+	return mailer.Notify("order_lookup", mailer.LocaleFor(order.Country), []string{order.Email}, map[string]interface{}{
+		"Order":   &order,
+		"URL":     orderURL(token),
+		"Minutes": int(LookupLinkTTL.Minutes()),
+	})
+}
+
+// OpenLookupLink consumes a one-time order link and starts a viewing session
+// for its order, returning the session token.
+func OpenLookupLink(ctx context.Context, token string) (string, uint, error) {
+	value, err := database.Cache.GetDel(ctx, lookupKey(token)).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", 0, ErrInvalidLookupToken
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	orderId, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return "", 0, ErrInvalidLookupToken
+	}
+
+	session, err := randomToken()
+	if err != nil {
+		return "", 0, err
+	}
+	if err := database.Cache.Set(ctx, lookupSessionKey(session), orderId, LookupSessionTTL).Err(); err != nil {
+		return "", 0, err
+	}
+
+	return session, uint(orderId), nil
+}
+
+// LookupSession returns the order a viewing session was started for and
+// when the session ends.
+func LookupSession(ctx context.Context, session string) (uint, time.Time, error) {
+	if session == "" {
+		return 0, time.Time{}, ErrInvalidLookupToken
+	}
+
+	pipe := database.Cache.Pipeline()
+	get := pipe.Get(ctx, lookupSessionKey(session))
+	ttl := pipe.TTL(ctx, lookupSessionKey(session))
+	if _, err := pipe.Exec(ctx); err != nil && !errors.Is(err, redis.Nil) {
+		return 0, time.Time{}, err
+	}
+
+	value, err := get.Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, time.Time{}, ErrInvalidLookupToken
+	}
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	orderId, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, time.Time{}, ErrInvalidLookupToken
+	}
+	return uint(orderId), time.Now().Add(ttl.Val()), nil
+}
+
+// orderURL returns the checkout frontend page that opens an order link.
+func orderURL(token string) string {
+	return BaseURL() + "/orders/view?token=" + url.QueryEscape(token)
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+func lookupKey(token string) string {
+	return "order_lookup:" + token
+}
+
+func lookupSessionKey(session string) string {
+	return "order_lookup_session:" + session
+}
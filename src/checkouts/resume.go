@@ -0,0 +1,51 @@
+package checkouts
+
+import (
+	"ambassador/src/database"
+	"context"
+	"errors"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"time"
+)
+
+// resumeTTL is how long a recovery link stays valid.
+const resumeTTL = 7 * 24 * time.Hour
+
+// ErrInvalidResumeToken is returned for unknown or expired resume tokens.
+var ErrInvalidResumeToken = errors.New("resume link is invalid or has expired")
+
+// IssueResumeToken creates a random token that identifies an expired order
+// for as long as its recovery link is valid.
+func IssueResumeToken(ctx context.Context, orderId uint) (string, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", err
+	}
+
+	if err := database.Cache.Set(ctx, resumeKey(token), orderId, resumeTTL).Err(); err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// ResumeOrderId returns the order a resume token was issued for.
+func ResumeOrderId(ctx context.Context, token string) (uint, error) {
+	value, err := database.Cache.Get(ctx, resumeKey(token)).Result()
+	if errors.Is(err, redis.Nil) {
+		return 0, ErrInvalidResumeToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidResumeToken
+	}
+	return uint(id), nil
+}
+
+func resumeKey(token string) string {
+	return "checkout_resume:" + token
+}
@@ -0,0 +1,24 @@
+package checkouts
+
+import (
+	"ambassador/src/scheduler"
+	"context"
+	"log"
+)
+
+// ExpiryJob periodically expires abandoned checkouts. The interval is read
+// from CHECKOUT_EXPIRY_INTERVAL (e.g. "15m").
+var ExpiryJob = scheduler.Job{
+	Name:        "Checkout expiry",
+	IntervalEnv: "CHECKOUT_EXPIRY_INTERVAL",
+	LockKey:     "checkouts:expiry:lock",
+	Run:         expireAbandoned,
+}
+
+func expireAbandoned(ctx context.Context) error {
+	report, err := ExpireAbandoned(ctx, Age(), RecoveryEnabled())
+	if report.Checked > 0 {
+		log.Printf("Checkout expiry: %+v", report)
+	}
+	return err
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"ambassador/src/checkouts"
+	"ambassador/src/database"
+	"context"
+	"encoding/json"
+	"log"
+	"os"
+)
+
+// Expires checkouts that were never paid, using the same age and recovery
+// email settings as the scheduler, and prints what was done.
+func main() {
+	database.Connect()
+	database.SetupRedis()
+	defer database.CloseRedis()
+
+	report, err := checkouts.ExpireAbandoned(context.Background(), checkouts.Age(), checkouts.RecoveryEnabled())
+
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(report); err != nil {
+		log.Printf("Failed to print report: %v", err)
+	}
+
+	if err != nil {
+		log.Fatalf("Failed to expire checkouts: %v", err)
+	}
+}
@@ -1,24 +1,36 @@
 package main
 
 import (
+	"ambassador/src/currency"
 	"ambassador/src/database"
 	"ambassador/src/models"
 	"github.com/go-faker/faker/v4"
+	"log"
 	"math/rand"
+	"time"
 )
 
 func main() {
 	database.Connect()
 
+	// Seed orders in the base currency
+	quote, err := currency.NewQuote(database.DB, currency.Base())
+	if err != nil {
+		log.Fatalf("Failed to quote the base currency: %v", err)
+	}
+
 	for i := 0; i < 30; i++ {
 		var orderItems []models.OrderItem
+		total := 0.0
 
 		for j := 0; j < rand.Intn(5); j++ {
 			price := float64(rand.Intn(90) + 10)
 			qty := uint(rand.Intn(5))
 
+			total += price * float64(qty)
 			orderItems = append(orderItems, models.OrderItem{
 				ProductTitle:      faker.Word(),
+				Currency:          quote.Currency,
 				Price:             price,
 				Quantity:          qty,
 				AdminRevenue:      0.9 * price * float64(qty),
@@ -31,6 +43,9 @@ func main() {
 		max := 64
 		randomNum := uint(min + rand.Intn(max-min+1))
 
+		// Spread orders over the last 90 days so time-series stats have data
+		completedAt := time.Now().Add(-time.Duration(rand.Intn(90*24)) * time.Hour)
+
 		database.DB.Create(&models.Order{
 			UserId:          randomNum,
 			Code:            faker.Username(),
@@ -38,7 +53,12 @@ func main() {
 			FirstName:       faker.FirstName(),
 			LastName:        faker.LastName(),
 			Email:           faker.Email(),
-			Complete:        true,
+			Status:          models.OrderPaid,
+			Currency:        quote.Currency,
+			ReportingRate:   quote.ReportingRate,
+			Total:           total,
+			CreatedAt:       completedAt,
+			CompletedAt:     &completedAt,
 			OrderItems:      orderItems,
 		})
 	}
@@ -2,28 +2,31 @@ package main
 
 import (
 	"ambassador/src/database"
-	"ambassador/src/models"
+	"ambassador/src/rankings"
 	"context"
-	"github.com/redis/go-redis/v9"
+	"encoding/json"
+	"log"
+	"os"
+	"time"
 )
 
+// Rebuilds every leaderboard window from the database and prints the drift
+// that was found between Redis and SQL.
 func main() {
 	database.Connect()
 	database.SetupRedis()
+	defer database.CloseRedis()
 
-	ctx := context.Background()
+	reports, err := rankings.RebuildAll(context.Background(), time.Now())
+	rankings.LogReports(reports)
 
-	var users []models.User
-
-	database.DB.Find(&users, models.User{IsAmbassador: true})
-
-	for _, user := range users {
-		ambassador := models.Ambassador(user)
-		ambassador.CalculateRevenue(database.DB)
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(reports); err != nil {
+		log.Printf("Failed to print report: %v", err)
+	}
 
-		database.Cache.ZAdd(ctx, "rankings", redis.Z{
-			Score:  *ambassador.Revenue,
-			Member: user.Name(),
-		})
+	if err != nil {
+		log.Fatalf("Failed to rebuild rankings: %v", err)
 	}
 }
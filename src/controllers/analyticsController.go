@@ -0,0 +1,182 @@
+package controllers
+
+import (
+	"ambassador/src/analytics"
+	"ambassador/src/database"
+	"ambassador/src/middlewares"
+	"ambassador/src/models"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const visitorCookie = "visitor_id"
+
+// AmbassadorAnalytics reports clicks, checkouts and orders for the
+// authenticated ambassador's links over a date range.
+func AmbassadorAnalytics(c *fiber.Ctx) error {
+	id, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	from, to, err := parseDateRange(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	// Include deleted links so their history is still reported
+	var codes []string
+	if err := database.DB.Unscoped().Model(&models.Link{}).Where("user_id = ?", id).Pluck("code", &codes).Error; err != nil {
+		log.Printf("Failed to fetch links: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch links",
+		})
+	}
+
+	return funnelResponse(c, codes, from, to)
+}
+
+// AdminAnalytics reports the funnel for every link, optionally narrowed down
+// by ambassador (user_id) or link code.
+func AdminAnalytics(c *fiber.Ctx) error {
+	from, to, err := parseDateRange(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	var codes []string
+	if code := c.Query("code"); code != "" {
+		codes = []string{code}
+	} else if userId := c.Query("user_id"); userId != "" {
+		id, err := strconv.Atoi(userId)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid user ID",
+			})
+		}
+		codes = []string{}
+		if err := database.DB.Unscoped().Model(&models.Link{}).Where("user_id = ?", id).Pluck("code", &codes).Error; err != nil {
+			log.Printf("Failed to fetch links: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to fetch links",
+			})
+		}
+	}
+
+	return funnelResponse(c, codes, from, to)
+}
+
+func funnelResponse(c *fiber.Ctx, codes []string, from time.Time, to time.Time) error {
+	funnels := []analytics.LinkFunnel{}
+
+	// An ambassador without links has nothing to report
+	if codes == nil || len(codes) > 0 {
+		var err error
+		funnels, err = analytics.Funnel(codes, from, to)
+		if err != nil {
+			log.Printf("Failed to aggregate link events: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to fetch analytics",
+			})
+		}
+	}
+
+	return c.JSON(fiber.Map{
+		"from":  from.Format("2006-01-02"),
+		"to":    to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"links": funnels,
+	})
+}
+
+// parseDateRange reads the inclusive from/to query parameters (YYYY-MM-DD),
+// defaulting to the last 30 days. The returned end is exclusive.
+func parseDateRange(c *fiber.Ctx) (time.Time, time.Time, error) {
+	now := time.Now()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.Local)
+	from := today.AddDate(0, 0, -29)
+	to := today
+
+	if value := c.Query("from"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return from, to, errors.New("invalid from date, expected YYYY-MM-DD")
+		}
+		from = parsed
+	}
+
+	if value := c.Query("to"); value != "" {
+		parsed, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return from, to, errors.New("invalid to date, expected YYYY-MM-DD")
+		}
+		to = parsed
+	}
+
+	if to.Before(from) {
+		return from, to, errors.New("from date must not be after to date")
+	}
+
+	return from, to.AddDate(0, 0, 1), nil
+}
+
+// linkEvent builds a funnel event for the link from the current request.
+func linkEvent(c *fiber.Ctx, link models.Link, eventType string) models.LinkEvent {
+	return models.LinkEvent{
+		LinkId:      link.Id,
+		Code:        link.Code,
+		Type:        eventType,
+		VisitorId:   truncate(c.Cookies(visitorCookie), 64),
+		Referrer:    truncate(c.Get(fiber.HeaderReferer), 512),
+		UserAgent:   truncate(c.Get(fiber.HeaderUserAgent), 512),
+		UtmSource:   truncate(c.Query("utm_source"), 128),
+		UtmMedium:   truncate(c.Query("utm_medium"), 128),
+		UtmCampaign: truncate(c.Query("utm_campaign"), 128),
+		UtmTerm:     truncate(c.Query("utm_term"), 128),
+		UtmContent:  truncate(c.Query("utm_content"), 128),
+	}
+}
+
+// recordVisit records a click on the link, issuing a visitor cookie on first
+// visit. Visitors without the cookie are also deduplicated by IP and user
+// agent, so clients that never keep it are not counted on every request.
+func recordVisit(c *fiber.Ctx, link models.Link) {
+	event := linkEvent(c, link, models.EventClick)
+
+	fingerprint := ""
+	if event.VisitorId == "" {
+		sum := sha256.Sum256([]byte(c.IP() + "|" + c.Get(fiber.HeaderUserAgent)))
+		fingerprint = hex.EncodeToString(sum[:])
+
+		event.VisitorId = uuid.NewString()
+		c.Cookie(&fiber.Cookie{
+			Name:     visitorCookie,
+			Value:    event.VisitorId,
+			Expires:  time.Now().AddDate(1, 0, 0),
+			HTTPOnly: true,
+		})
+	}
+
+	go analytics.RecordVisit(event, fingerprint)
+}
+
+// truncate copies s, shortened to at most n bytes so it fits its column.
+// Fiber reuses request buffers, so values kept after the handler must be copied.
+func truncate(s string, n int) string {
+	if len(s) > n {
+		s = s[:n]
+	}
+	return strings.Clone(s)
+}
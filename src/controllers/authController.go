@@ -146,7 +146,7 @@ func User(c *fiber.Ctx) error {
 	// Check if the request is from the ambassador endpoint
 	if strings.Contains(c.Path(), "/api/ambassador") {
 		// Fetch orders and calculate revenue
-		revenue, err := calculateRevenueForUser(user.Id, database.DB)
+		orders, err := revenueOrdersForUser(user.Id, database.DB)
 		if err != nil {
 			log.Printf("Failed to calculate ambassador revenue: %v", err)
 			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -156,7 +156,7 @@ func User(c *fiber.Ctx) error {
 
 		// Create an ambassador and set the revenue
 		ambassador := models.Ambassador(user)
-		ambassador.Revenue = &revenue
+		ambassador.SetRevenue(orders)
 		return c.JSON(ambassador)
 	}
 
@@ -164,25 +164,17 @@ func User(c *fiber.Ctx) error {
 	return c.JSON(user)
 }
 
-// calculateRevenueForUser calculates the revenue for a specific user
-func calculateRevenueForUser(userID uint, db *gorm.DB) (float64, error) {
+// revenueOrdersForUser fetches the revenue-generating orders of a specific user
+func revenueOrdersForUser(userID uint, db *gorm.DB) ([]models.Order, error) {
 	var orders []models.Order
 
 	// Fetch all completed orders and order items for the user
-	if err := db.Preload("OrderItems").Where("user_id = ? AND complete = ?", userID, true).Find(&orders).Error; err != nil {
+	if err := db.Preload("OrderItems").Where("user_id = ? AND status IN ?", userID, models.RevenueStatuses).Find(&orders).Error; err != nil {
 		log.Printf("Failed to fetch orders for user %d: %v", userID, err)
-		return 0, err
+		return nil, err
 	}
 
-	// Calculate revenue
-	var revenue float64 = 0.0
-	for _, order := range orders {
-		for _, orderItem := range order.OrderItems {
-			revenue += orderItem.AmbassadorRevenue
-		}
-	}
-
-	return revenue, nil
+	return orders, nil
 }
 
 // Logout by remove cookie. remove cookie by set it expired one hour
@@ -0,0 +1,234 @@
+package controllers
+
+import (
+	"ambassador/src/coupons"
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"strconv"
+	"time"
+)
+
+// CouponRequest defines the request body for creating or updating a coupon.
+type CouponRequest struct {
+	Code               string     `json:"code"`
+	Type               string     `json:"type"`
+	Value              float64    `json:"value"`
+	Scope              string     `json:"scope"`
+	Products           []int      `json:"products"`
+	MaxUses            uint       `json:"max_uses"`
+	MaxUsesPerCustomer uint       `json:"max_uses_per_customer"`
+	StartsAt           *time.Time `json:"starts_at"`
+	EndsAt             *time.Time `json:"ends_at"`
+	LinkId             *uint      `json:"link_id"`
+	Active             *bool      `json:"active"`
+}
+
+// Coupons returns all coupons with their usage counts.
+func Coupons(c *fiber.Ctx) error {
+	var couponList []models.Coupon
+	if err := database.DB.Preload("Products").Order("id DESC").Find(&couponList).Error; err != nil {
+		log.Printf("Failed to fetch coupons: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch coupons",
+		})
+	}
+
+	for i := range couponList {
+		uses, err := coupons.CountRedemptions(database.DB, couponList[i].Id)
+		if err != nil {
+			log.Printf("Failed to count coupon uses: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to fetch coupons",
+			})
+		}
+		couponList[i].Uses = uses
+	}
+
+	return c.JSON(couponList)
+}
+
+// GetCoupon retrieves a single coupon by ID.
+func GetCoupon(c *fiber.Ctx) error {
+	coupon, err := fetchCoupon(c)
+	if err != nil {
+		return couponLookupError(c, err)
+	}
+
+	if coupon.Uses, err = coupons.CountRedemptions(database.DB, coupon.Id); err != nil {
+		log.Printf("Failed to count coupon uses: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch coupon",
+		})
+	}
+
+	return c.JSON(coupon)
+}
+
+// CreateCoupon creates a new coupon.
+func CreateCoupon(c *fiber.Ctx) error {
+	var coupon models.Coupon
+	if err := bindCoupon(c, &coupon); err != nil {
+		return couponSaveError(c, err)
+	}
+
+	if err := database.DB.Create(&coupon).Error; err != nil {
+		return couponSaveError(c, err)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(coupon)
+}
+
+// UpdateCoupon replaces the settings of an existing coupon.
+func UpdateCoupon(c *fiber.Ctx) error {
+	coupon, err := fetchCoupon(c)
+	if err != nil {
+		return couponLookupError(c, err)
+	}
+
+	if err := bindCoupon(c, &coupon); err != nil {
+		return couponSaveError(c, err)
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Omit("Products").Save(&coupon).Error; err != nil {
+			return err
+		}
+		return tx.Model(&coupon).Association("Products").Replace(coupon.Products)
+	})
+	if err != nil {
+		return couponSaveError(c, err)
+	}
+
+	return c.JSON(coupon)
+}
+
+// DeleteCoupon soft-deletes a coupon so past redemptions keep their reference.
+func DeleteCoupon(c *fiber.Ctx) error {
+	coupon, err := fetchCoupon(c)
+	if err != nil {
+		return couponLookupError(c, err)
+	}
+
+	if err := database.DB.Delete(&coupon).Error; err != nil {
+		log.Printf("Failed to delete coupon: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to delete coupon",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Coupon deleted successfully",
+	})
+}
+
+// bindCoupon parses and validates the request body into the coupon.
+func bindCoupon(c *fiber.Ctx, coupon *models.Coupon) error {
+	var request CouponRequest
+	if err := c.BodyParser(&request); err != nil {
+		return requestError{status: fiber.StatusBadRequest, message: "Invalid request body"}
+	}
+
+	// Fetch the products the coupon is restricted to in one query
+	var products []models.Product
+	if len(request.Products) > 0 {
+		if err := database.DB.Where("id IN ?", request.Products).Find(&products).Error; err != nil {
+			log.Printf("Failed to fetch products: %v", err)
+			return requestError{status: fiber.StatusInternalServerError, message: "Failed to fetch products"}
+		}
+		if len(products) != len(uniqueInts(request.Products)) {
+			return requestError{status: fiber.StatusBadRequest, message: "Invalid product ID"}
+		}
+	}
+
+	// Ambassador-exclusive coupons must point at an existing link
+	if request.LinkId != nil {
+		var count int64
+		if err := database.DB.Model(&models.Link{}).Where("id = ?", *request.LinkId).Count(&count).Error; err != nil || count == 0 {
+			return requestError{status: fiber.StatusBadRequest, message: "Invalid link ID"}
+		}
+	}
+
+	coupon.Code = request.Code
+	coupon.Type = request.Type
+	coupon.Value = request.Value
+	coupon.Scope = request.Scope
+	coupon.Products = products
+	coupon.MaxUses = request.MaxUses
+	coupon.MaxUsesPerCustomer = request.MaxUsesPerCustomer
+	coupon.StartsAt = request.StartsAt
+	coupon.EndsAt = request.EndsAt
+	coupon.LinkId = request.LinkId
+	coupon.Active = request.Active == nil || *request.Active
+
+	if err := coupons.Normalize(coupon); err != nil {
+		return requestError{status: fiber.StatusBadRequest, message: err.Error()}
+	}
+
+	return nil
+}
+
+// fetchCoupon loads the coupon in the :id parameter with its products.
+func fetchCoupon(c *fiber.Ctx) (models.Coupon, error) {
+	var coupon models.Coupon
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return coupon, errInvalidCouponId
+	}
+
+	err = database.DB.Preload("Products").First(&coupon, id).Error
+	return coupon, err
+}
+
+var errInvalidCouponId = errors.New("invalid coupon ID")
+
+func couponLookupError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errInvalidCouponId):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid coupon ID",
+		})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Coupon not found",
+		})
+	}
+
+	log.Printf("Failed to fetch coupon: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"message": "Failed to fetch coupon",
+	})
+}
+
+// requestError carries the response for an invalid request.
+type requestError struct {
+	status  int
+	message string
+}
+
+func (e requestError) Error() string {
+	return e.message
+}
+
+func couponSaveError(c *fiber.Ctx, err error) error {
+	var invalid requestError
+	if errors.As(err, &invalid) {
+		return c.Status(invalid.status).JSON(fiber.Map{
+			"message": invalid.message,
+		})
+	}
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": "Coupon code is already taken",
+		})
+	}
+
+	log.Printf("Failed to save coupon: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"message": "Failed to save coupon",
+	})
+}
@@ -0,0 +1,210 @@
+package controllers
+
+import (
+	"ambassador/src/currency"
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"strconv"
+)
+
+// ExchangeRates returns the base and reporting currencies with every exchange rate.
+func ExchangeRates(c *fiber.Ctx) error {
+	var rates []models.ExchangeRate
+	if err := database.DB.Order("currency").Find(&rates).Error; err != nil {
+		log.Printf("Failed to fetch exchange rates: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch exchange rates",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"base":      currency.Base(),
+		"reporting": currency.Reporting(),
+		"rates":     rates,
+	})
+}
+
+// SetExchangeRateRequest defines the request body for setting an exchange rate.
+type SetExchangeRateRequest struct {
+	Rate float64 `json:"rate"`
+}
+
+// SetExchangeRate creates or replaces the rate of a currency against the base currency.
+func SetExchangeRate(c *fiber.Ctx) error {
+	code, err := currency.Normalize(c.Params("currency"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+	if code == currency.Base() {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "The base currency has no exchange rate",
+		})
+	}
+
+	var request SetExchangeRateRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+	if request.Rate <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Rate must be greater than 0",
+		})
+	}
+
+	// Insert the rate or replace the existing one
+	rate := models.ExchangeRate{Currency: code, Rate: request.Rate}
+	err = database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "updated_at"}),
+	}).Create(&rate).Error
+	if err != nil {
+		log.Printf("Failed to save exchange rate: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to save exchange rate",
+		})
+	}
+
+	return c.JSON(rate)
+}
+
+// DeleteExchangeRate removes the rate of a currency, which stops it from
+// being used at checkout.
+func DeleteExchangeRate(c *fiber.Ctx) error {
+	code, err := currency.Normalize(c.Params("currency"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	result := database.DB.Where("currency = ?", code).Delete(&models.ExchangeRate{})
+	if result.Error != nil {
+		log.Printf("Failed to delete exchange rate: %v", result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to delete exchange rate",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Exchange rate not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Exchange rate deleted successfully",
+	})
+}
+
+// SetProductPriceRequest defines the request body for setting a product price.
+type SetProductPriceRequest struct {
+	Price float64 `json:"price"`
+}
+
+// SetProductPrice fixes the price of a product in a currency instead of
+// converting its base price.
+func SetProductPrice(c *fiber.Ctx) error {
+	product, code, err := productPriceTarget(c)
+	if err != nil {
+		return productPriceError(c, err)
+	}
+
+	var request SetProductPriceRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+	if request.Price <= 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Price must be greater than 0",
+		})
+	}
+
+	// Insert the price or replace the existing one
+	price := models.ProductPrice{ProductId: product.Id, Currency: code, Price: currency.Round(request.Price)}
+	err = database.DB.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "product_id"}, {Name: "currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"price"}),
+	}).Create(&price).Error
+	if err != nil {
+		log.Printf("Failed to save product price: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to save product price",
+		})
+	}
+
+	return c.JSON(price)
+}
+
+// DeleteProductPrice removes the price of a product in a currency so its base
+// price is converted again.
+func DeleteProductPrice(c *fiber.Ctx) error {
+	product, code, err := productPriceTarget(c)
+	if err != nil {
+		return productPriceError(c, err)
+	}
+
+	result := database.DB.Where("product_id = ? AND currency = ?", product.Id, code).Delete(&models.ProductPrice{})
+	if result.Error != nil {
+		log.Printf("Failed to delete product price: %v", result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to delete product price",
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Product price not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "Product price deleted successfully",
+	})
+}
+
+// productPriceTarget fetches the product and currency named in the URL.
+func productPriceTarget(c *fiber.Ctx) (models.Product, string, error) {
+	var product models.Product
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return product, "", requestError{status: fiber.StatusBadRequest, message: "Invalid product ID"}
+	}
+
+	code, err := currency.Normalize(c.Params("currency"))
+	if err != nil {
+		return product, "", requestError{status: fiber.StatusBadRequest, message: err.Error()}
+	}
+
+	if err := database.DB.First(&product, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return product, "", requestError{status: fiber.StatusNotFound, message: "Product not found"}
+		}
+		return product, "", err
+	}
+
+	return product, code, nil
+}
+
+func productPriceError(c *fiber.Ctx, err error) error {
+	var invalid requestError
+	if errors.As(err, &invalid) {
+		return c.Status(invalid.status).JSON(fiber.Map{
+			"message": invalid.message,
+		})
+	}
+
+	log.Printf("Failed to fetch product: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"message": "Failed to fetch product",
+	})
+}
@@ -0,0 +1,90 @@
+package controllers
+
+import (
+	"ambassador/src/middlewares"
+	"ambassador/src/realtime"
+	"bufio"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"time"
+)
+
+// AdminEvents streams new orders, completed sales and ranking changes of
+// every ambassador as Server-Sent Events.
+func AdminEvents(c *fiber.Ctx) error {
+	return streamEvents(c, realtime.AdminStream)
+}
+
+// AmbassadorEvents streams the authenticated ambassador's new orders,
+// completed sales and ranking changes as Server-Sent Events.
+func AmbassadorEvents(c *fiber.Ctx) error {
+	id, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	return streamEvents(c, realtime.AmbassadorStream(id))
+}
+
+// streamEvents replays the events after the client's Last-Event-ID, then
+// streams live events with a heartbeat until the client disconnects.
+func streamEvents(c *fiber.Ctx, stream string) error {
+	lastEventId := c.Get("Last-Event-ID", c.Query("last_event_id"))
+
+	// Subscribe before replaying so nothing published in between is lost
+	events, unsubscribe := realtime.Subscribe(stream)
+
+	missed, err := realtime.Since(c.Context(), stream, lastEventId)
+	if err != nil {
+		log.Printf("Failed to replay %s events: %v", stream, err)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer unsubscribe()
+
+		fmt.Fprintf(w, "retry: %d\n\n", realtime.RetryInterval.Milliseconds())
+		last := lastEventId
+		for _, event := range missed {
+			w.WriteString(event.Format())
+			last = event.Id
+		}
+		if err := w.Flush(); err != nil {
+			return
+		}
+
+		heartbeat := time.NewTicker(realtime.HeartbeatInterval)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case event, ok := <-events:
+				if !ok {
+					return
+				}
+				// Skip events that were already replayed
+				if !realtime.After(event.Id, last) {
+					continue
+				}
+				w.WriteString(event.Format())
+				last = event.Id
+			case <-heartbeat.C:
+				w.WriteString(": heartbeat\n\n")
+			}
+
+			// A failed flush means the client went away
+			if err := w.Flush(); err != nil {
+				return
+			}
+		}
+	})
+
+	return nil
+}
@@ -0,0 +1,199 @@
+package controllers
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/exports"
+	"ambassador/src/middlewares"
+	"ambassador/src/models"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"os"
+	"strconv"
+	"time"
+)
+
+// ExportOrders streams the orders matching the listing filters as CSV or XLSX.
+func ExportOrders(c *fiber.Ctx) error {
+	filter, err := parseOrderFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	return streamExport(c, exports.TypeOrders, exports.Orders(filter))
+}
+
+// ExportAmbassadors streams every ambassador with their revenue as CSV or XLSX.
+func ExportAmbassadors(c *fiber.Ctx) error {
+	return streamExport(c, exports.TypeAmbassadors, exports.Ambassadors())
+}
+
+// streamExport writes the dataset straight to the response as it is read
+// from the database. Errors after the first bytes are sent can only be logged.
+func streamExport(c *fiber.Ctx, name string, dataset exports.Dataset) error {
+	format := c.Query("format", exports.FormatCSV)
+	if !exports.ValidFormat(format) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": exports.ErrInvalidFormat.Error(),
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, exports.ContentType(format))
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf(`attachment; filename="%s-%s.%s"`, name, time.Now().Format("20060102"), format))
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		writer, err := exports.NewWriter(format, w)
+		if err != nil {
+			log.Printf("Failed to start %s export: %v", name, err)
+			return
+		}
+		if err := dataset(context.Background(), writer); err != nil {
+			log.Printf("Failed to export %s: %v", name, err)
+		}
+		if err := writer.Close(); err != nil {
+			log.Printf("Failed to finish %s export: %v", name, err)
+		}
+		w.Flush()
+	})
+
+	return nil
+}
+
+// CreateExportRequest defines the request body for starting an export job.
+// Order exports take the listing filters from the query string.
+type CreateExportRequest struct {
+	Type   string `json:"type"`
+	Format string `json:"format"`
+}
+
+// CreateExport starts an export job that produces a downloadable file.
+func CreateExport(c *fiber.Ctx) error {
+	var request CreateExportRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	if request.Format == "" {
+		request.Format = exports.FormatCSV
+	}
+	if !exports.ValidFormat(request.Format) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": exports.ErrInvalidFormat.Error(),
+		})
+	}
+
+	export := models.Export{Type: request.Type, Format: request.Format, Status: models.ExportPending}
+
+	switch request.Type {
+	case exports.TypeOrders:
+		filter, err := parseOrderFilter(c)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		encoded, _ := json.Marshal(filter)
+		export.Filter = string(encoded)
+	case exports.TypeAmbassadors:
+	default:
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": exports.ErrInvalidType.Error(),
+		})
+	}
+
+	userId, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+	export.UserId = userId
+
+	if err := database.DB.Create(&export).Error; err != nil {
+		log.Printf("Failed to create export: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to create export",
+		})
+	}
+
+	exports.Start(export)
+
+	return c.Status(fiber.StatusAccepted).JSON(export)
+}
+
+// GetExport reports the status of an export job.
+func GetExport(c *fiber.Ctx) error {
+	export, err := fetchExport(c)
+	if err != nil {
+		return exportLookupError(c, err)
+	}
+
+	return c.JSON(export)
+}
+
+// DownloadExport sends the file of a completed export job.
+func DownloadExport(c *fiber.Ctx) error {
+	export, err := fetchExport(c)
+	if err != nil {
+		return exportLookupError(c, err)
+	}
+
+	if export.Status != models.ExportCompleted {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": "Export is " + export.Status,
+		})
+	}
+
+	// The file is missing when EXPORT_DIR is not shared by every instance
+	if _, err := os.Stat(export.Path); err != nil {
+		log.Printf("Failed to open file of export %d: %v", export.Id, err)
+		return c.Status(fiber.StatusGone).JSON(fiber.Map{
+			"message": "Export file is no longer available",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, exports.ContentType(export.Format))
+	return c.Download(export.Path, exports.FileName(export))
+}
+
+var errInvalidExportId = errors.New("invalid export ID")
+
+// fetchExport loads the export job in the :id parameter.
+func fetchExport(c *fiber.Ctx) (models.Export, error) {
+	var export models.Export
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return export, errInvalidExportId
+	}
+
+	err = database.DB.First(&export, id).Error
+	return export, err
+}
+
+func exportLookupError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errInvalidExportId) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid export ID",
+		})
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Export not found",
+		})
+	}
+
+	log.Printf("Failed to fetch export: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"message": "Failed to fetch export",
+	})
+}
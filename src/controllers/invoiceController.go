@@ -0,0 +1,92 @@
+package controllers
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/invoices"
+	"ambassador/src/models"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"strconv"
+)
+
+// OrderInvoice returns the PDF invoice of a paid order, issuing its invoice
+// number the first time it is requested.
+func OrderInvoice(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid order ID",
+		})
+	}
+
+	return sendInvoice(c, uint(id))
+}
+
+// CustomerInvoice returns the PDF invoice of an order to a customer holding
+// the signed link from their confirmation email.
+func CustomerInvoice(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid order ID",
+		})
+	}
+
+	// Verify the link before revealing whether the order exists
+	if err := invoices.Verify(uint(id), c.Query("expires"), c.Query("signature")); err != nil {
+		if errors.Is(err, invoices.ErrLinkExpired) {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{
+				"message": "Invoice link has expired",
+			})
+		}
+		return c.Status(fiber.StatusForbidden).JSON(fiber.Map{
+			"message": "Invalid invoice link",
+		})
+	}
+
+	return sendInvoice(c, uint(id))
+}
+
+func sendInvoice(c *fiber.Ctx, id uint) error {
+	// Fetch the order with its items
+	var order models.Order
+	if err := database.DB.Preload("OrderItems").First(&order, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Order not found",
+			})
+		}
+		log.Printf("Failed to fetch order: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch order",
+		})
+	}
+
+	invoice, err := invoices.Issue(&order)
+	if err != nil {
+		if errors.Is(err, invoices.ErrNotInvoiceable) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": "Order is " + order.Status + " and has no invoice",
+			})
+		}
+		log.Printf("Failed to issue invoice for order %d: %v", order.Id, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to issue invoice",
+		})
+	}
+
+	document, err := invoices.Render(order, invoice)
+	if err != nil {
+		log.Printf("Failed to render invoice %s: %v", invoice.Reference(), err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to render invoice",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, "application/pdf")
+	c.Set(fiber.HeaderContentDisposition, fmt.Sprintf("inline; filename=%q", invoices.FileName(invoice)))
+	return c.Send(document)
+}
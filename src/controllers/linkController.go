@@ -1,14 +1,22 @@
 package controllers
 
 import (
+	"ambassador/src/analytics"
+	"ambassador/src/checkouts"
+	"ambassador/src/currency"
 	"ambassador/src/database"
+	"ambassador/src/linkcode"
 	"ambassador/src/middlewares"
 	"ambassador/src/models"
+	"ambassador/src/qr"
+	"ambassador/src/webhooks"
 	"errors"
-	"github.com/go-faker/faker/v4"
 	"github.com/gofiber/fiber/v2"
 	"gorm.io/gorm"
+	"log"
 	"strconv"
+	"strings"
+	"time"
 )
 
 func Link(c *fiber.Ctx) error {
@@ -32,8 +40,8 @@ func Link(c *fiber.Ctx) error {
 	// GORM Query (Using COUNT DISTINCT for orders)
 	err = database.DB.
 		Table("links AS l").
-		Select("l.id, l.code, COUNT(DISTINCT o.id) AS order_count, COALESCE(SUM(oi.price * oi.quantity), 0) AS total").
-		Joins("LEFT JOIN orders o ON l.code = o.code AND o.complete = ?", true).
+		Select("l.id, l.code, COUNT(DISTINCT o.id) AS order_count, COALESCE(SUM((oi.price * oi.quantity - oi.discount) * (oi.quantity - oi.refunded_quantity) / oi.quantity * o.reporting_rate), 0) AS total").
+		Joins("LEFT JOIN orders o ON l.code = o.code AND o.status IN ?", models.RevenueStatuses).
 		Joins("LEFT JOIN order_items oi ON o.id = oi.order_id").
 		Where("l.user_id = ?", id).
 		Group("l.id, l.code").
@@ -50,7 +58,11 @@ func Link(c *fiber.Ctx) error {
 
 // CreateLinkRequest defines the request body for creating a link.
 type CreateLinkRequest struct {
-	Products []int `json:"products" validate:"required,min=1"`
+	Code      string     `json:"code"`
+	Products  []int      `json:"products" validate:"required,min=1"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	MaxUses   uint       `json:"max_uses"`
+	Currency  string     `json:"currency"`
 }
 
 // CreateLink creates a new link for the user.
@@ -71,6 +83,29 @@ func CreateLink(c *fiber.Ctx) error {
 		})
 	}
 
+	// Validate the expiry date
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Expiry date must be in the future",
+		})
+	}
+
+	// Validate the vanity code if the ambassador chose one
+	request.Code = strings.TrimSpace(request.Code)
+	if request.Code != "" {
+		if err := linkcode.Validate(request.Code); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+	}
+
+	// Validate the checkout currency if the ambassador chose one
+	checkoutCurrency, err := linkCurrency(request.Currency)
+	if err != nil {
+		return currencyLookupError(c, err)
+	}
+
 	// Get the user ID from the middleware
 	id, err := middlewares.GetUserId(c)
 	if err != nil {
@@ -79,34 +114,98 @@ func CreateLink(c *fiber.Ctx) error {
 		})
 	}
 
-	// Create the link
+	// Create the link; generated codes are assigned when it is saved
 	link := models.Link{
-		UserId: id,
-		Code:   faker.Username(),
+		UserId:    id,
+		Code:      request.Code,
+		Active:    true,
+		ExpiresAt: request.ExpiresAt,
+		MaxUses:   request.MaxUses,
+		Currency:  checkoutCurrency,
 	}
 
-	// Fetch and associate products with the link
-	for _, productId := range request.Products {
-		product := models.Product{}
-		if err := database.DB.First(&product, productId).Error; err != nil {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"message": "Invalid product ID",
-			})
-		}
-		link.Products = append(link.Products, product)
+	// Fetch the products to associate with the link in one query
+	if err := database.DB.Where("id IN ?", request.Products).Find(&link.Products).Error; err != nil {
+		log.Printf("Failed to fetch products: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch products",
+		})
 	}
+	if len(link.Products) != len(uniqueInts(request.Products)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid product ID",
+		})
+	}
+
+	// Save the link; vanity codes are stored as-is, others get a collision-free code
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if link.Code != "" {
+			if err := tx.Create(&link).Error; err != nil {
+				return err
+			}
+		} else if err := database.CreateLinkWithUniqueCode(tx, &link); err != nil {
+			return err
+		}
 
-	// Save the link to the database
-	if err := database.DB.Create(&link).Error; err != nil {
+		return webhooks.Publish(tx, webhooks.EventLinkCreated, link.UserId, webhooks.LinkCreated(link))
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": "Code is already taken",
+			})
+		}
+		log.Printf("Failed to create link: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to create link",
 		})
 	}
 
+	webhooks.Wake()
+
 	return c.JSON(link)
 }
 
-// Stats fetches statistics for all links of the user.
+// CheckLinkCode reports whether a vanity code is valid and still available.
+func CheckLinkCode(c *fiber.Ctx) error {
+	code := strings.TrimSpace(c.Query("code"))
+
+	// Validate the code format before hitting the database
+	if err := linkcode.Validate(code); err != nil {
+		return c.JSON(fiber.Map{
+			"code":      code,
+			"available": false,
+			"message":   err.Error(),
+		})
+	}
+
+	// Check whether another link already uses the code, including deleted ones
+	var count int64
+	if err := database.DB.Unscoped().Model(&models.Link{}).Where("code = ?", code).Count(&count).Error; err != nil {
+		log.Printf("Failed to check link code: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to check code",
+		})
+	}
+
+	if count > 0 {
+		return c.JSON(fiber.Map{
+			"code":      code,
+			"available": false,
+			"message":   "Code is already taken",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"code":      code,
+		"available": true,
+	})
+}
+
+// Stats reports completed orders, revenue and commission per link over a date
+// range, bucketed by day, week or month. With compare=true each link also
+// carries the totals of the preceding period of the same length. Amounts are
+// in the reporting currency, with a breakdown per order currency.
 func Stats(c *fiber.Ctx) error {
 	id, err := middlewares.GetUserId(c)
 	if err != nil {
@@ -115,6 +214,26 @@ func Stats(c *fiber.Ctx) error {
 		})
 	}
 
+	// Parse the date range and granularity
+	from, to, err := parseDateRange(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	granularity := c.Query("granularity", analytics.GranularityDay)
+	if !analytics.ValidGranularity(granularity) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Granularity must be day, week or month",
+		})
+	}
+	if err := analytics.CheckPeriods(from, to, granularity); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
 	// Fetch all links for the user
 	var links []models.Link
 	if err := database.DB.Where("user_id = ?", id).Find(&links).Error; err != nil {
@@ -129,58 +248,506 @@ func Stats(c *fiber.Ctx) error {
 		linkCodes[i] = link.Code
 	}
 
-	// Fetch all orders for the link codes in one query
-	var orders []models.Order
-	if err := database.DB.Preload("OrderItems").Where("code IN (?) AND complete = ?", linkCodes, true).Find(&orders).Error; err != nil {
+	// Aggregate the orders of all links in SQL
+	series, err := analytics.Sales(linkCodes, from, to, granularity)
+	if err != nil {
+		log.Printf("Failed to aggregate orders: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch orders",
+		})
+	}
+
+	// Report the same totals in each order currency
+	byCurrency, err := analytics.SalesTotalsByCurrency(linkCodes, from, to)
+	if err != nil {
+		log.Printf("Failed to aggregate orders by currency: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to fetch orders",
 		})
 	}
 
-	// Group orders by link code
-	ordersByCode := make(map[string][]models.Order)
-	for _, order := range orders {
-		ordersByCode[order.Code] = append(ordersByCode[order.Code], order)
+	var previous map[string]analytics.SalesTotals
+	if c.QueryBool("compare") {
+		previous, err = analytics.SalesTotalsByCode(linkCodes, from.Add(-to.Sub(from)), from)
+		if err != nil {
+			log.Printf("Failed to aggregate previous orders: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to fetch orders",
+			})
+		}
 	}
 
 	// Prepare the result
 	result := make([]fiber.Map, 0, len(links))
 	for _, link := range links {
-		orders := ordersByCode[link.Code]
-		revenue := 0.0
-		for _, order := range orders {
-			revenue += order.GetTotal()
+		var totals analytics.SalesTotals
+		for _, point := range series[link.Code] {
+			totals.Orders += point.Orders
+			totals.Revenue += point.Revenue
+			totals.Commission += point.Commission
 		}
 
-		result = append(result, fiber.Map{
-			"code":    link.Code,
-			"count":   len(orders),
-			"revenue": revenue,
-		})
+		entry := fiber.Map{
+			"code":        link.Code,
+			"currency":    currency.Reporting(),
+			"count":       totals.Orders,
+			"revenue":     totals.Revenue,
+			"commission":  totals.Commission,
+			"series":      series[link.Code],
+			"by_currency": byCurrency[link.Code],
+		}
+
+		if previous != nil {
+			entry["previous"] = previous[link.Code]
+			entry["change"] = fiber.Map{
+				"count":      change(float64(totals.Orders), float64(previous[link.Code].Orders)),
+				"revenue":    change(totals.Revenue, previous[link.Code].Revenue),
+				"commission": change(totals.Commission, previous[link.Code].Commission),
+			}
+		}
+
+		result = append(result, entry)
 	}
 
 	return c.JSON(result)
 }
 
+// change returns the relative change from previous to current, or nil when
+// there is no previous value to compare against.
+func change(current float64, previous float64) *float64 {
+	if previous == 0 {
+		return nil
+	}
+	ratio := (current - previous) / previous
+	return &ratio
+}
+
 // GetLink fetches a link by its code.
 func GetLink(c *fiber.Ctx) error {
 	code := c.Params("code")
 
-	// Fetch the link with the given code and preload User and Products
-	var link models.Link
-	result := database.DB.Preload("User").Preload("Products").Where("code = ?", code).First(&link)
-
-	// Check if the link was found
-	if result.Error != nil {
-		if errors.Is(result.Error, gorm.ErrRecordNotFound) {
+	// Fetch the link and make sure it can still be used for checkout
+	link, err := findCheckoutLink(code)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"message": "Link not found",
 			})
 		}
+		if models.IsUnavailable(err) {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch link",
+		})
+	}
+
+	// Show prices in the requested currency or the link's own
+	quote, err := checkoutQuote(c.Query("currency"), link)
+	if err != nil {
+		return currencyLookupError(c, err)
+	}
+	if err := quoteProducts(link.Products, quote); err != nil {
+		log.Printf("Failed to fetch product prices: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch product prices",
+		})
+	}
+	link.Currency = quote.Currency
+
+	// Track the visit for the link's conversion funnel
+	recordVisit(c, link)
+
+	return c.JSON(link)
+}
+
+// quoteProducts replaces the base prices of products with their prices in the
+// quoted currency.
+func quoteProducts(products []models.Product, quote currency.Quote) error {
+	if len(products) == 0 {
+		return nil
+	}
+
+	ids := make([]uint, len(products))
+	for i, product := range products {
+		ids[i] = product.Id
+	}
+
+	var prices []models.ProductPrice
+	if err := database.DB.Where("product_id IN ? AND currency = ?", ids, quote.Currency).Find(&prices).Error; err != nil {
+		return err
+	}
+
+	for i := range products {
+		for _, price := range prices {
+			if price.ProductId == products[i].Id {
+				products[i].Prices = append(products[i].Prices, price)
+			}
+		}
+		products[i].Price = quote.Price(products[i])
+		products[i].Prices = nil
+	}
+
+	return nil
+}
+
+// linkCurrency validates the currency an ambassador chose for a link. An empty
+// currency leaves the choice to the base currency.
+func linkCurrency(code string) (string, error) {
+	if strings.TrimSpace(code) == "" {
+		return "", nil
+	}
+
+	quote, err := currency.NewQuote(database.DB, code)
+	if err != nil {
+		return "", err
+	}
+	return quote.Currency, nil
+}
+
+// currencyLookupError responds to an error returned while quoting a currency.
+func currencyLookupError(c *fiber.Ctx, err error) error {
+	if isCurrencyError(err) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	log.Printf("Failed to fetch exchange rates: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"message": "Failed to fetch exchange rates",
+	})
+}
+
+// findCheckoutLink fetches a link with its user and products by code and
+// returns an availability error when it is paused, expired, used up or deleted.
+func findCheckoutLink(code string) (models.Link, error) {
+	var link models.Link
+	if err := database.DB.Unscoped().Preload("User").Preload("Products").Where("code = ?", code).First(&link).Error; err != nil {
+		return link, err
+	}
+
+	// Only count uses when the link has a limit
+	var uses int64
+	if link.MaxUses > 0 {
+		counts, err := countLinkUses([]string{link.Code})
+		if err != nil {
+			return link, err
+		}
+		uses = counts[link.Code]
+	}
+
+	return link, link.CheckAvailable(uses, time.Now())
+}
+
+// countLinkUses counts completed orders per link code.
+func countLinkUses(codes []string) (map[string]int64, error) {
+	type useCount struct {
+		Code  string
+		Count int64
+	}
+
+	var rows []useCount
+	err := database.DB.Model(&models.Order{}).
+		Select("code, COUNT(*) AS count").
+		Where("code IN ? AND status IN ?", codes, models.RevenueStatuses).
+		Group("code").
+		Scan(&rows).Error
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Code] = row.Count
+	}
+
+	return counts, nil
+}
+
+// AmbassadorLinks lists the authenticated ambassador's links with their products.
+func AmbassadorLinks(c *fiber.Ctx) error {
+	id, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	// Fetch all links of the user
+	var links []models.Link
+	if err := database.DB.Preload("Products").Where("user_id = ?", id).Order("id DESC").Find(&links).Error; err != nil {
+		log.Printf("Failed to fetch links: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch links",
+		})
+	}
+
+	// Attach the number of uses to each link
+	codes := make([]string, len(links))
+	for i, link := range links {
+		codes[i] = link.Code
+	}
+
+	counts, err := countLinkUses(codes)
+	if err != nil {
+		log.Printf("Failed to count link uses: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch links",
+		})
+	}
+
+	for i := range links {
+		links[i].Uses = counts[links[i].Code]
+	}
+
+	return c.JSON(links)
+}
+
+// AmbassadorLink returns a single link owned by the authenticated ambassador.
+func AmbassadorLink(c *fiber.Ctx) error {
+	link, err := fetchOwnLink(c)
+	if err != nil {
+		return linkLookupError(c, err)
+	}
+
+	counts, err := countLinkUses([]string{link.Code})
+	if err != nil {
+		log.Printf("Failed to count link uses: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to fetch link",
 		})
 	}
+	link.Uses = counts[link.Code]
+
+	return c.JSON(link)
+}
+
+// UpdateLinkRequest defines the request body for updating a link. It replaces
+// the link's products, limits and currency; a missing expiry, zero max uses or
+// empty currency removes them.
+type UpdateLinkRequest struct {
+	Products  []int      `json:"products"`
+	ExpiresAt *time.Time `json:"expires_at"`
+	MaxUses   uint       `json:"max_uses"`
+	Currency  string     `json:"currency"`
+}
+
+// UpdateLink replaces the products, expiry date, usage limit and currency of a link.
+func UpdateLink(c *fiber.Ctx) error {
+	var request UpdateLinkRequest
+
+	// Parse the request body
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	// Validate the request
+	if len(request.Products) == 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "At least one product is required",
+		})
+	}
+	if request.ExpiresAt != nil && !request.ExpiresAt.After(time.Now()) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Expiry date must be in the future",
+		})
+	}
+
+	checkoutCurrency, err := linkCurrency(request.Currency)
+	if err != nil {
+		return currencyLookupError(c, err)
+	}
+
+	link, err := fetchOwnLink(c)
+	if err != nil {
+		return linkLookupError(c, err)
+	}
+
+	// Fetch the requested products in one query
+	var products []models.Product
+	if err := database.DB.Where("id IN ?", request.Products).Find(&products).Error; err != nil {
+		log.Printf("Failed to fetch products: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch products",
+		})
+	}
+	if len(products) != len(uniqueInts(request.Products)) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid product ID",
+		})
+	}
+
+	// Update the settings and products together
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&link).Updates(map[string]interface{}{
+			"expires_at":         request.ExpiresAt,
+			"expiry_notified_at": nil, // report the new expiry date when it passes
+			"max_uses":           request.MaxUses,
+			"currency":           checkoutCurrency,
+		}).Error; err != nil {
+			return err
+		}
+		return tx.Model(&link).Association("Products").Replace(products)
+	})
+	if err != nil {
+		log.Printf("Failed to update link: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update link",
+		})
+	}
+
+	// Cached QR codes describe the old link state
+	go qr.Invalidate(link.Code)
+
+	link.Products = products
+	return c.JSON(link)
+}
+
+// PauseLink stops a link from accepting new checkouts.
+func PauseLink(c *fiber.Ctx) error {
+	return setLinkActive(c, false)
+}
+
+// ResumeLink lets a paused link accept checkouts again.
+func ResumeLink(c *fiber.Ctx) error {
+	return setLinkActive(c, true)
+}
+
+func setLinkActive(c *fiber.Ctx, active bool) error {
+	link, err := fetchOwnLink(c)
+	if err != nil {
+		return linkLookupError(c, err)
+	}
+
+	if err := database.DB.Model(&link).Update("active", active).Error; err != nil {
+		log.Printf("Failed to update link: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update link",
+		})
+	}
+
+	go qr.Invalidate(link.Code)
 
 	return c.JSON(link)
 }
+
+// DeleteLink soft-deletes a link so its code stays reserved and past orders keep resolving.
+func DeleteLink(c *fiber.Ctx) error {
+	link, err := fetchOwnLink(c)
+	if err != nil {
+		return linkLookupError(c, err)
+	}
+
+	if err := database.DB.Delete(&link).Error; err != nil {
+		log.Printf("Failed to delete link: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to delete link",
+		})
+	}
+
+	go qr.Invalidate(link.Code)
+
+	return c.JSON(fiber.Map{
+		"message": "Link deleted successfully",
+	})
+}
+
+// LinkQRCode renders the checkout URL of a link as a PNG or SVG QR code.
+func LinkQRCode(c *fiber.Ctx) error {
+	options := qr.Options{
+		Format: c.Query("format", qr.FormatPNG),
+		Size:   c.QueryInt("size", qr.DefaultSize),
+		Level:  c.Query("level", "M"),
+		Margin: c.QueryInt("margin", qr.DefaultMargin),
+	}
+
+	// Validate the rendering options
+	if err := options.Validate(); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	link, err := fetchOwnLink(c)
+	if err != nil {
+		return linkLookupError(c, err)
+	}
+
+	data, err := qr.RenderCached(link.Code, checkouts.URL(link.Code), options)
+	if err != nil {
+		log.Printf("Failed to render QR code: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to render QR code",
+		})
+	}
+
+	c.Set(fiber.HeaderContentType, options.ContentType())
+	c.Set(fiber.HeaderCacheControl, "private, max-age=3600")
+	return c.Send(data)
+}
+
+var (
+	errUnauthorized  = errors.New("unauthorized")
+	errInvalidLinkId = errors.New("invalid link ID")
+)
+
+// fetchOwnLink loads the link in the :id parameter if it belongs to the authenticated user.
+func fetchOwnLink(c *fiber.Ctx) (models.Link, error) {
+	var link models.Link
+
+	userId, err := middlewares.GetUserId(c)
+	if err != nil {
+		return link, errUnauthorized
+	}
+
+	linkId, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return link, errInvalidLinkId
+	}
+
+	err = database.DB.Preload("Products").Where("id = ? AND user_id = ?", linkId, userId).First(&link).Error
+	return link, err
+}
+
+// linkLookupError converts a fetchOwnLink error into a response.
+func linkLookupError(c *fiber.Ctx, err error) error {
+	switch {
+	case errors.Is(err, errUnauthorized):
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	case errors.Is(err, errInvalidLinkId):
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid link ID",
+		})
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Link not found",
+		})
+	}
+
+	log.Printf("Failed to fetch link: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"message": "Failed to fetch link",
+	})
+}
+
+// uniqueInts returns the distinct values of ids, keeping their order.
+func uniqueInts(ids []int) []int {
+	seen := make(map[int]bool, len(ids))
+	unique := make([]int, 0, len(ids))
+
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+
+	return unique
+}
@@ -0,0 +1,181 @@
+package controllers
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/middlewares"
+	"ambassador/src/models"
+	"ambassador/src/notifications"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"strconv"
+)
+
+// Notifications returns a page of the user's notifications, newest first,
+// with the number of unread ones. Pass unread=true for unread ones only.
+func Notifications(c *fiber.Ctx) error {
+	userId, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	page := c.QueryInt("page", 1)
+	if page <= 0 {
+		page = 1
+	}
+	perPage := c.QueryInt("per_page", 20)
+	if perPage <= 0 || perPage > 100 {
+		perPage = 20
+	}
+
+	query := database.DB.Model(&models.Notification{}).Where("user_id = ?", userId)
+	if c.QueryBool("unread") {
+		query = query.Where("read_at IS NULL")
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Failed to count notifications: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch notifications",
+		})
+	}
+
+	var list []models.Notification
+	if err := query.Order("id DESC").Offset((page - 1) * perPage).Limit(perPage).Find(&list).Error; err != nil {
+		log.Printf("Failed to fetch notifications: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch notifications",
+		})
+	}
+
+	unread, err := notifications.Unread(database.DB, userId)
+	if err != nil {
+		log.Printf("Failed to count unread notifications: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch notifications",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": list,
+		"meta": fiber.Map{
+			"total":     total,
+			"page":      page,
+			"last_page": (total + int64(perPage) - 1) / int64(perPage),
+			"unread":    unread,
+		},
+	})
+}
+
+// ReadNotification marks one of the user's notifications as read.
+func ReadNotification(c *fiber.Ctx) error {
+	userId, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid notification ID",
+		})
+	}
+
+	notification, err := notifications.MarkRead(database.DB, userId, uint(id))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Notification not found",
+			})
+		}
+
+		log.Printf("Failed to mark notification %d as read: %v", id, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update notification",
+		})
+	}
+
+	return c.JSON(notification)
+}
+
+// ReadAllNotifications marks every unread notification of the user as read.
+func ReadAllNotifications(c *fiber.Ctx) error {
+	userId, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	updated, err := notifications.MarkAllRead(database.DB, userId)
+	if err != nil {
+		log.Printf("Failed to mark notifications as read: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to update notifications",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"updated": updated,
+	})
+}
+
+// NotificationPreferences returns, for every notification type, whether the
+// user is notified by email, in the app and through their webhooks.
+func NotificationPreferences(c *fiber.Ctx) error {
+	userId, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	preferences, err := notifications.Preferences(database.DB, userId)
+	if err != nil {
+		log.Printf("Failed to fetch notification preferences: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch notification preferences",
+		})
+	}
+
+	return c.JSON(preferences)
+}
+
+// UpdateNotificationPreferences sets the channels of the notification types
+// in the request body. Types left out keep their current channels.
+func UpdateNotificationPreferences(c *fiber.Ctx) error {
+	userId, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var request []models.NotificationPreference
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	if err := notifications.SetPreferences(database.DB, userId, request); err != nil {
+		if errors.Is(err, notifications.ErrInvalidType) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+
+		log.Printf("Failed to save notification preferences: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to save notification preferences",
+		})
+	}
+
+	return NotificationPreferences(c)
+}
@@ -1,38 +1,242 @@
 package controllers
 
 import (
+	"ambassador/src/analytics"
+	"ambassador/src/checkouts"
+	"ambassador/src/coupons"
+	"ambassador/src/currency"
 	"ambassador/src/database"
+	"ambassador/src/middlewares"
 	"ambassador/src/models"
-	"context"
+	"ambassador/src/notifications"
+	"ambassador/src/orders"
+	"ambassador/src/outbox"
+	"ambassador/src/realtime"
+	"ambassador/src/shipping"
+	"ambassador/src/tax"
+	"ambassador/src/webhooks"
 	"errors"
 	"fmt"
 	"github.com/gofiber/fiber/v2"
 	"github.com/stripe/stripe-go/v81"
 	"github.com/stripe/stripe-go/v81/checkout/session"
+	"golang.org/x/text/language"
 	"gorm.io/gorm"
 	"log"
-	"net/smtp"
+	"math"
 	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
 )
 
-// Orders fetches all orders with their order items and calculates totals.
+// Orders lists orders page by page, newest first unless sorted otherwise.
+// The cursor of the next page is returned in meta.next_cursor.
 func Orders(c *fiber.Ctx) error {
-	var orders []models.Order
+	filter, err := parseOrderFilter(c)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	sort, err := orders.ParseSort(c.Query("sort"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	limit := c.QueryInt("limit", orders.DefaultLimit)
 
-	// Fetch all orders with their order items
-	if err := database.DB.Preload("OrderItems").Find(&orders).Error; err != nil {
+	// Fetch one page of orders
+	page, next, err := orders.Page(database.DB, filter, sort, c.Query("cursor"), limit)
+	if err != nil {
+		if errors.Is(err, orders.ErrInvalidCursor) {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		log.Printf("Failed to fetch orders: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to fetch orders",
 		})
 	}
 
-	// Calculate the total for each order
-	for i, order := range orders {
-		orders[i].Name = order.FullName()
-		orders[i].Total = order.GetTotal()
+	for i, order := range page {
+		page[i].Name = order.FullName()
 	}
 
-	return c.JSON(orders)
+	return c.JSON(fiber.Map{
+		"data": page,
+		"meta": fiber.Map{
+			"sort":        sort.String(),
+			"count":       len(page),
+			"next_cursor": next,
+		},
+	})
+}
+
+// GetOrder returns an order with its items, status history and refunds.
+func GetOrder(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid order ID",
+		})
+	}
+
+	var order models.Order
+	err = database.DB.
+		Preload("OrderItems").
+		Preload("StatusHistory", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Preload("Refunds.RefundItems").
+		First(&order, id).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Order not found",
+			})
+		}
+		log.Printf("Failed to fetch order: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch order",
+		})
+	}
+	order.Name = order.FullName()
+
+	return c.JSON(fiber.Map{
+		"order":         order,
+		"charged_total": order.GetChargedTotal(),
+		"payment": fiber.Map{
+			"provider":            "stripe",
+			"checkout_session_id": order.TransactionId,
+			"payment_intent_id":   order.PaymentIntentId,
+		},
+	})
+}
+
+// CancelOrderRequest defines the request body for cancelling an order.
+type CancelOrderRequest struct {
+	Reason string `json:"reason"`
+}
+
+// CancelOrder cancels an unpaid order, closing its Stripe checkout so it can
+// no longer be paid. Paid orders must be refunded instead.
+func CancelOrder(c *fiber.Ctx) error {
+	adminId, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid order ID",
+		})
+	}
+
+	var request CancelOrderRequest
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(&request); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid request body",
+			})
+		}
+	}
+
+	// Fetch the order
+	var order models.Order
+	if err := database.DB.First(&order, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Order not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch order",
+		})
+	}
+
+	if err := checkouts.Cancel(&order, models.ActorAdmin(adminId), strings.TrimSpace(request.Reason)); err != nil {
+		var invalid models.ErrInvalidTransition
+		switch {
+		case errors.As(err, &invalid):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": "Order cannot be cancelled from status " + invalid.From,
+			})
+		case errors.Is(err, checkouts.ErrPaidUnconfirmed):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": "Order was paid in Stripe and must be refunded instead",
+			})
+		}
+		log.Printf("Failed to cancel order %d: %v", order.Id, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to cancel order",
+		})
+	}
+
+	return c.JSON(order)
+}
+
+// parseOrderFilter reads the order filters from the query string: status
+// (comma-separated), user_id, code, from and to (YYYY-MM-DD, inclusive),
+// email, min_total and max_total.
+func parseOrderFilter(c *fiber.Ctx) (orders.Filter, error) {
+	var filter orders.Filter
+
+	if value := c.Query("status"); value != "" {
+		for _, status := range strings.Split(value, ",") {
+			status = strings.TrimSpace(status)
+			if !slices.Contains(models.OrderStatuses, status) {
+				return filter, fmt.Errorf("unknown status %q", status)
+			}
+			filter.Statuses = append(filter.Statuses, status)
+		}
+	}
+
+	if value := c.Query("user_id"); value != "" {
+		userId, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return filter, errors.New("invalid user_id")
+		}
+		filter.UserId = uint(userId)
+	}
+
+	filter.Code = strings.TrimSpace(c.Query("code"))
+	filter.Email = strings.TrimSpace(c.Query("email"))
+
+	if value := c.Query("from"); value != "" {
+		from, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return filter, errors.New("invalid from date, expected YYYY-MM-DD")
+		}
+		filter.From = &from
+	}
+
+	if value := c.Query("to"); value != "" {
+		to, err := time.ParseInLocation("2006-01-02", value, time.Local)
+		if err != nil {
+			return filter, errors.New("invalid to date, expected YYYY-MM-DD")
+		}
+		to = to.AddDate(0, 0, 1)
+		filter.To = &to
+	}
+
+	for name, target := range map[string]**float64{"min_total": &filter.MinTotal, "max_total": &filter.MaxTotal} {
+		if value := c.Query(name); value != "" {
+			total, err := strconv.ParseFloat(value, 64)
+			if err != nil {
+				return filter, fmt.Errorf("invalid %s", name)
+			}
+			*target = &total
+		}
+	}
+
+	return filter, nil
 }
 
 // CreateOrderRequest defines the request body for creating an order.
@@ -43,8 +247,11 @@ type CreateOrderRequest struct {
 	Address   string           `json:"address" validate:"required"`
 	Country   string           `json:"country" validate:"required"`
 	City      string           `json:"city" validate:"required"`
+	Region    string           `json:"region"`
 	Zip       string           `json:"zip" validate:"required"`
 	Code      string           `json:"code" validate:"required"`
+	Coupon    string           `json:"coupon"`
+	Currency  string           `json:"currency"`
 	Products  []map[string]int `json:"products" validate:"required,min=1"`
 }
 
@@ -66,29 +273,78 @@ func CreateOrder(c *fiber.Ctx) error {
 		})
 	}
 
-	// Validate product quantities
-	for _, product := range request.Products {
-		if product["quantity"] < 1 {
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"message": "Quantity for each product must be at least 1",
-			})
-		}
+	// Tax rates and shipping rules are keyed by country code, so names would silently match none
+	country, err := countryCode(request.Country)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+	request.Country = country
+
+	// Validate product quantities and merge repeated products
+	productIds, quantities, err := mergeProductLines(request.Products)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
 	}
 
-	// Fetch the link associated with the order
-	link := models.Link{}
-	if err := database.DB.Preload("User").Where("code = ?", request.Code).First(&link).Error; err != nil {
+	// Fetch the link associated with the order and make sure it is still usable
+	link, err := findCheckoutLink(request.Code)
+	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
 				"message": "Invalid link!",
 			})
 		}
+		if models.IsUnavailable(err) {
+			return c.Status(fiber.StatusGone).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to fetch link",
 		})
 	}
 
-	// Create the order
+	// Quote prices in the requested currency, falling back to the link's
+	quote, err := checkoutQuote(request.Currency, link)
+	if err != nil {
+		return currencyLookupError(c, err)
+	}
+
+	// Fetch every product with its price in the quoted currency in one query
+	var found []models.Product
+	if err := database.DB.Preload("Prices", "currency = ?", quote.Currency).Where("id IN ?", productIds).Find(&found).Error; err != nil {
+		log.Printf("Failed to fetch products: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch products",
+		})
+	}
+	if len(found) != len(productIds) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid product ID",
+		})
+	}
+
+	// Build the cart lines in the order the products were requested
+	byId := make(map[uint]models.Product, len(found))
+	for _, product := range found {
+		byId[product.Id] = product
+	}
+
+	products := make([]models.Product, len(productIds))
+	lines := make([]coupons.Line, len(productIds))
+	for i, productId := range productIds {
+		products[i] = byId[productId]
+		lines[i] = coupons.Line{
+			ProductId: productId,
+			Price:     quote.Price(products[i]),
+			Quantity:  quantities[i],
+		}
+	}
+
 	order := models.Order{
 		Code:            link.Code,
 		UserId:          link.UserId,
@@ -99,77 +355,51 @@ func CreateOrder(c *fiber.Ctx) error {
 		Address:         request.Address,
 		Country:         request.Country,
 		City:            request.City,
+		Region:          request.Region,
 		Zip:             request.Zip,
+		Currency:        quote.Currency,
+		ReportingRate:   quote.ReportingRate,
 	}
 
-	// Start a database transaction
-	tx := database.DB.Begin()
-	defer func() {
-		if r := recover(); r != nil {
-			tx.Rollback()
+	// Price the cart and store the order with its items in one transaction
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		return placeOrder(tx, &order, link, request.Coupon, products, lines, quote)
+	})
+	if err != nil {
+		var invalid requestError
+		if errors.As(err, &invalid) {
+			return c.Status(invalid.status).JSON(fiber.Map{
+				"message": invalid.message,
+			})
 		}
-	}()
-
-	// Save the order to the database
-	if err := tx.Create(&order).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": err.Error(),
+		log.Printf("Failed to create order: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to create order",
 		})
 	}
 
 	// Prepare line items for Stripe checkout
 	var lineItems []*stripe.CheckoutSessionLineItemParams
+	for i, item := range order.OrderItems {
+		lineItems = append(lineItems, stripeLineItems(products[i], item.Quantity, item.GetTotal(), order.Currency)...)
+	}
 
-	for _, requestProduct := range request.Products {
-		product := models.Product{}
-		if err := database.DB.First(&product, requestProduct["product_id"]).Error; err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"message": "Invalid product ID",
-			})
-		}
-
-		total := product.Price * float64(requestProduct["quantity"])
-
-		item := models.OrderItem{
-			OrderId:           order.Id,
-			ProductTitle:      product.Title,
-			Price:             product.Price,
-			Quantity:          uint(requestProduct["quantity"]),
-			AmbassadorRevenue: 0.1 * total,
-			AdminRevenue:      0.9 * total,
-		}
-
-		// Save the order item to the database
-		if err := tx.Create(&item).Error; err != nil {
-			tx.Rollback()
-			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-				"message": err.Error(),
-			})
-		}
-
-		lineItems = append(lineItems, &stripe.CheckoutSessionLineItemParams{
-			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
-				Currency: stripe.String("usd"),
-				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
-					Name:        stripe.String(product.Title),
-					Description: stripe.String(product.Description),
-					Images:      []*string{stripe.String(product.Image)},
-				},
-				UnitAmount: stripe.Int64(100 * int64(product.Price)), // Price in cents
-			},
-			Quantity: stripe.Int64(int64(requestProduct["quantity"])),
-		})
+	// Exclusive tax and shipping are charged on top of the products
+	if !order.TaxInclusive && order.Tax > 0 {
+		lineItems = append(lineItems, stripeChargeLine("Tax", order.Tax, order.Currency))
+	}
+	if order.Shipping > 0 {
+		lineItems = append(lineItems, stripeChargeLine("Shipping", order.Shipping, order.Currency))
 	}
 
 	// Set the Stripe secret key
 	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
 
-	// Create a Stripe checkout session
+	// Create the Stripe checkout session outside the transaction so no
+	// database locks are held during the remote call
 	params := stripe.CheckoutSessionParams{
-		SuccessURL:         stripe.String("http://localhost:5000/success?source={CHECKOUT_SESSION_ID}"),
-		CancelURL:          stripe.String("http://localhost:5000/error"),
+		SuccessURL:         stripe.String(checkouts.BaseURL() + "/success?source={CHECKOUT_SESSION_ID}"),
+		CancelURL:          stripe.String(checkouts.BaseURL() + "/error"),
 		PaymentMethodTypes: stripe.StringSlice([]string{"card"}),
 		LineItems:          lineItems,
 		Mode:               stripe.String("payment"),
@@ -177,27 +407,178 @@ func CreateOrder(c *fiber.Ctx) error {
 
 	source, err := session.New(&params)
 	if err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": err.Error(),
+		// Fail the order so its coupon redemption no longer counts
+		abandonCheckout(&order, "Checkout session could not be created")
+		log.Printf("Failed to create checkout session for order %d: %v", order.Id, err)
+		return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+			"message": "Failed to create checkout session",
 		})
 	}
 
-	// Update the order with the Stripe transaction ID
-	order.TransactionId = source.ID
-	if err := tx.Save(&order).Error; err != nil {
-		tx.Rollback()
-		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
-			"message": err.Error(),
+	// Link the order to the Stripe transaction
+	if err := database.DB.Model(&order).Update("transaction_id", source.ID).Error; err != nil {
+		// Without the reference the session could never be confirmed
+		if _, expireErr := session.Expire(source.ID, nil); expireErr != nil {
+			log.Printf("Failed to expire checkout session %s: %v", source.ID, expireErr)
+		}
+		abandonCheckout(&order, "Checkout session could not be stored")
+		log.Printf("Failed to store checkout session for order %d: %v", order.Id, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to create order",
 		})
 	}
 
-	// Commit the transaction
-	tx.Commit()
+	// Track the checkout start for the link's conversion funnel
+	analytics.Record(linkEvent(c, link, models.EventCheckout))
+
+	// Show the new order on the live dashboards
+	if err := realtime.PublishOrder(c.Context(), realtime.EventOrderCreated, order); err != nil {
+		log.Printf("Failed to publish order %d: %v", order.Id, err)
+	}
 
 	return c.JSON(source)
 }
 
+// placeOrder applies the coupon, calculates tax and shipping and stores the
+// order with its items. It runs inside the checkout transaction so the coupon
+// stays locked until the order is committed.
+func placeOrder(tx *gorm.DB, order *models.Order, link models.Link, code string, products []models.Product, lines []coupons.Line, quote currency.Quote) error {
+	// Apply the coupon
+	discounts := make([]float64, len(lines))
+	var coupon models.Coupon
+	if code != "" {
+		var err error
+		coupon, discounts, err = coupons.Redeem(tx, code, link, order.Email, lines, quote)
+		if err != nil {
+			if isCouponError(err) {
+				return requestError{status: fiber.StatusBadRequest, message: err.Error()}
+			}
+			return fmt.Errorf("redeem coupon: %w", err)
+		}
+
+		for _, discount := range discounts {
+			order.Discount += discount
+		}
+		order.CouponCode = coupon.Code
+	}
+
+	// Calculate tax on the discounted lines and shipping for the whole cart
+	amounts := make([]float64, len(lines))
+	subtotal, weight := 0.0, 0.0
+	for i, line := range lines {
+		amounts[i] = line.Total() - discounts[i]
+		subtotal += amounts[i]
+		weight += products[i].Weight * float64(line.Quantity)
+	}
+
+	taxes, err := tax.Default.Calculate(order.Country, order.Region, amounts)
+	if err != nil {
+		return fmt.Errorf("calculate tax: %w", err)
+	}
+
+	// Shipping rules are priced in the base currency
+	baseShipping, err := shipping.Default.Calculate(order.Country, quote.ToBase(subtotal), weight)
+	if err != nil {
+		return fmt.Errorf("calculate shipping: %w", err)
+	}
+	order.Total = currency.Round(subtotal)
+	order.Shipping = quote.FromBase(baseShipping)
+	order.Tax = taxes.Total
+	order.TaxInclusive = taxes.Inclusive
+
+	order.OrderItems = make([]models.OrderItem, len(lines))
+	for i, product := range products {
+		// Commission is earned on what the customer pays, excluding tax and shipping
+		commissionBase := amounts[i]
+		if taxes.Inclusive {
+			commissionBase -= taxes.Lines[i]
+		}
+
+		order.OrderItems[i] = models.OrderItem{
+			ProductId:         product.Id,
+			ProductTitle:      product.Title,
+			Currency:          quote.Currency,
+			Price:             lines[i].Price,
+			Quantity:          lines[i].Quantity,
+			Discount:          discounts[i],
+			Tax:               taxes.Lines[i],
+			AmbassadorRevenue: 0.1 * commissionBase,
+			AdminRevenue:      0.9 * commissionBase,
+		}
+	}
+
+	// Save the order together with its items
+	if err := tx.Create(order).Error; err != nil {
+		return fmt.Errorf("create order: %w", err)
+	}
+
+	if code != "" {
+		redemption := models.CouponRedemption{
+			CouponId: coupon.Id,
+			OrderId:  order.Id,
+			Email:    strings.ToLower(order.Email),
+			Discount: order.Discount,
+		}
+		if err := tx.Create(&redemption).Error; err != nil {
+			return fmt.Errorf("create coupon redemption: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// abandonCheckout fails an order whose checkout session could not be set up.
+func abandonCheckout(order *models.Order, reason string) {
+	if err := order.Transition(database.DB, models.OrderFailed, models.ActorSystem, reason); err != nil {
+		log.Printf("Failed to mark order %d as failed: %v", order.Id, err)
+	}
+}
+
+var errInvalidCountry = errors.New("country must be a two-letter ISO 3166-1 code, e.g. FR")
+
+// countryCode checks that country is an ISO 3166-1 alpha-2 code and returns
+// it in upper case, with deprecated codes such as UK replaced by current ones.
+func countryCode(country string) (string, error) {
+	country = strings.ToUpper(strings.TrimSpace(country))
+	region, err := language.ParseRegion(country)
+	if len(country) != 2 || err != nil || !region.IsCountry() {
+		return "", errInvalidCountry
+	}
+	return region.Canonicalize().String(), nil
+}
+
+// mergeProductLines validates the requested products and merges repeated
+// ones, returning their IDs in request order with the summed quantities.
+func mergeProductLines(requested []map[string]int) ([]uint, []uint, error) {
+	if len(requested) == 0 {
+		return nil, nil, requestError{status: fiber.StatusBadRequest, message: "At least one product is required"}
+	}
+
+	index := make(map[uint]int, len(requested))
+	productIds := make([]uint, 0, len(requested))
+	quantities := make([]uint, 0, len(requested))
+
+	for _, product := range requested {
+		if product["quantity"] < 1 {
+			return nil, nil, requestError{status: fiber.StatusBadRequest, message: "Quantity for each product must be at least 1"}
+		}
+		if product["product_id"] < 1 {
+			return nil, nil, requestError{status: fiber.StatusBadRequest, message: "Invalid product ID"}
+		}
+
+		productId := uint(product["product_id"])
+		if i, ok := index[productId]; ok {
+			quantities[i] += uint(product["quantity"])
+			continue
+		}
+		index[productId] = len(productIds)
+		productIds = append(productIds, productId)
+		quantities = append(quantities, uint(product["quantity"]))
+	}
+
+	return productIds, quantities, nil
+}
+
 func CompleteOrder(c *fiber.Ctx) error {
 	var data map[string]string
 
@@ -229,49 +610,208 @@ func CompleteOrder(c *fiber.Ctx) error {
 		})
 	}
 
-	// Mark the order as complete
-	order.Complete = true
-	if err := database.DB.Save(&order).Error; err != nil {
+	// Confirming an order that was already paid is a no-op
+	if isConfirmed(order.Status) {
+		return c.JSON(fiber.Map{
+			"message": "success",
+		})
+	}
+
+	// Mark the order as paid and record its side effects in the same transaction
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := order.Transition(tx, models.OrderPaid, models.ActorCustomer, "Checkout confirmed"); err != nil {
+			return err
+		}
+
+		events, err := outbox.OrderCompleted(order)
+		if err != nil {
+			return err
+		}
+		if err := outbox.Enqueue(tx, events...); err != nil {
+			return err
+		}
+		if err := notifications.OrderCompleted(tx, order); err != nil {
+			return err
+		}
+
+		return webhooks.Publish(tx, webhooks.EventOrderCompleted, order.UserId, webhooks.OrderCompleted(order))
+	})
+	if err != nil {
+		var invalid models.ErrInvalidTransition
+		if errors.As(err, &invalid) {
+			// A concurrent confirmation may have won the race
+			var current models.Order
+			if err := database.DB.Select("status").First(&current, order.Id).Error; err == nil && isConfirmed(current.Status) {
+				return c.JSON(fiber.Map{
+					"message": "success",
+				})
+			}
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": "Order cannot be completed from status " + invalid.From,
+			})
+		}
+		log.Printf("Failed to complete order %d: %v", order.Id, err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to update order",
 		})
 	}
 
-	// Calculate ambassador and admin revenue
-	ambassadorRevenue := 0.0
-	adminRevenue := 0.0
-	for _, item := range order.OrderItems {
-		ambassadorRevenue += item.AmbassadorRevenue
-		adminRevenue += item.AdminRevenue
+	// Rankings, notifications and the invoice are handled by the outbox dispatcher
+	outbox.Wake()
+	webhooks.Wake()
+
+	if err := realtime.PublishOrder(c.Context(), realtime.EventOrderCompleted, order); err != nil {
+		log.Printf("Failed to publish order %d: %v", order.Id, err)
 	}
 
-	// Fetch the user associated with the order
-	var user models.User
-	if err := database.DB.First(&user, "id = ?", order.UserId).Error; err != nil {
+	// Track the completed order for the link's conversion funnel
+	analytics.Record(models.LinkEvent{
+		Code:      order.Code,
+		Type:      models.EventOrder,
+		VisitorId: truncate(c.Cookies(visitorCookie), 64),
+	})
+
+	return c.JSON(fiber.Map{
+		"message": "success",
+	})
+}
+
+// ResumeCheckout returns the cart of an expired checkout from a recovery
+// link so the customer can place it again.
+func ResumeCheckout(c *fiber.Ctx) error {
+	orderId, err := checkouts.ResumeOrderId(c.Context(), c.Params("token"))
+	if err != nil {
+		if errors.Is(err, checkouts.ErrInvalidResumeToken) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		log.Printf("Failed to look up resume token: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
-			"message": "Failed to fetch user",
+			"message": "Failed to resume checkout",
+		})
+	}
+
+	// Fetch the expired order with its items
+	var order models.Order
+	if err := database.DB.Preload("OrderItems").First(&order, orderId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": checkouts.ErrInvalidResumeToken.Error(),
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch order",
 		})
 	}
 
-	// Update rankings in Redis
-	if err := database.Cache.ZIncrBy(context.Background(), "rankings", ambassadorRevenue, user.Name()).Err(); err != nil {
-		log.Printf("Failed to update rankings in Redis: %v", err)
+	// Rebuild the request body that created the order
+	products := make([]map[string]int, 0, len(order.OrderItems))
+	for _, item := range order.OrderItems {
+		if item.ProductId == 0 {
+			continue
+		}
+		products = append(products, map[string]int{
+			"product_id": int(item.ProductId),
+			"quantity":   int(item.Quantity),
+		})
 	}
 
-	// Send emails asynchronously
-	go func(order models.Order, ambassadorRevenue, adminRevenue float64) {
-		ambassadorMessage := []byte(fmt.Sprintf("You earned $%f from the link #%s", ambassadorRevenue, order.Code))
-		if err := smtp.SendMail("host.docker.internal:1025", nil, "no-reply@email.com", []string{order.AmbassadorEmail}, ambassadorMessage); err != nil {
-			log.Printf("Failed to send email to ambassador: %v", err)
+	return c.JSON(CreateOrderRequest{
+		FirstName: order.FirstName,
+		LastName:  order.LastName,
+		Email:     order.Email,
+		Address:   order.Address,
+		Country:   order.Country,
+		City:      order.City,
+		Region:    order.Region,
+		Zip:       order.Zip,
+		Code:      order.Code,
+		Coupon:    order.CouponCode,
+		Currency:  order.Currency,
+		Products:  products,
+	})
+}
+
+// isConfirmed reports whether an order in the given status was already paid.
+func isConfirmed(status string) bool {
+	return status == models.OrderPaid || status == models.OrderPartiallyRefunded || status == models.OrderRefunded
+}
+
+// stripeLineItems converts a discounted cart line into Stripe line items.
+// Stripe only accepts whole-cent unit prices, so when the discounted total
+// does not divide evenly the line is split in two with prices one cent apart.
+func stripeLineItems(product models.Product, quantity uint, total float64, currencyCode string) []*stripe.CheckoutSessionLineItemParams {
+	totalCents := int64(math.Round(total * 100))
+	unitCents := totalCents / int64(quantity)
+	remainder := totalCents - unitCents*int64(quantity)
+
+	lineItem := func(unitAmount int64, quantity int64) *stripe.CheckoutSessionLineItemParams {
+		return &stripe.CheckoutSessionLineItemParams{
+			PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+				Currency: stripe.String(strings.ToLower(currencyCode)),
+				ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+					Name:        stripe.String(product.Title),
+					Description: stripe.String(product.Description),
+					Images:      []*string{stripe.String(product.Image)},
+				},
+				UnitAmount: stripe.Int64(unitAmount), // Price in cents
+			},
+			Quantity: stripe.Int64(quantity),
 		}
+	}
 
-		adminMessage := []byte(fmt.Sprintf("Order #%d with a total of $%f has been completed", order.Id, adminRevenue))
-		if err := smtp.SendMail("host.docker.internal:1025", nil, "no-reply@email.com", []string{"admin@admin.com"}, adminMessage); err != nil {
-			log.Printf("Failed to send email to admin: %v", err)
+	if remainder == 0 {
+		return []*stripe.CheckoutSessionLineItemParams{lineItem(unitCents, int64(quantity))}
+	}
+
+	items := []*stripe.CheckoutSessionLineItemParams{lineItem(unitCents+1, remainder)}
+	if int64(quantity) > remainder {
+		items = append(items, lineItem(unitCents, int64(quantity)-remainder))
+	}
+	return items
+}
+
+// stripeChargeLine builds a single Stripe line item for a charge such as tax or shipping.
+func stripeChargeLine(name string, amount float64, currencyCode string) *stripe.CheckoutSessionLineItemParams {
+	return &stripe.CheckoutSessionLineItemParams{
+		PriceData: &stripe.CheckoutSessionLineItemPriceDataParams{
+			Currency: stripe.String(strings.ToLower(currencyCode)),
+			ProductData: &stripe.CheckoutSessionLineItemPriceDataProductDataParams{
+				Name: stripe.String(name),
+			},
+			UnitAmount: stripe.Int64(int64(math.Round(amount * 100))), // Price in cents
+		},
+		Quantity: stripe.Int64(1),
+	}
+}
+
+// isCouponError reports whether err explains why a coupon cannot be used.
+func isCouponError(err error) bool {
+	for _, target := range []error{
+		coupons.ErrNotFound, coupons.ErrInactive, coupons.ErrNotStarted, coupons.ErrExpired, coupons.ErrExhausted,
+		coupons.ErrCustomerLimit, coupons.ErrWrongLink, coupons.ErrNotApplicable,
+	} {
+		if errors.Is(err, target) {
+			return true
 		}
-	}(order, ambassadorRevenue, adminRevenue)
+	}
+	return false
+}
 
-	return c.JSON(fiber.Map{
-		"message": "success",
-	})
+// checkoutQuote quotes the requested currency, or the link's currency, or the
+// base currency when neither is set.
+func checkoutQuote(code string, link models.Link) (currency.Quote, error) {
+	if strings.TrimSpace(code) == "" {
+		code = link.Currency
+	}
+	if code == "" {
+		code = currency.Base()
+	}
+	return currency.NewQuote(database.DB, code)
+}
+
+// isCurrencyError reports whether err explains why a currency cannot be used.
+func isCurrencyError(err error) bool {
+	return errors.Is(err, currency.ErrInvalid) || errors.Is(err, currency.ErrZeroDecimal) || errors.Is(err, currency.ErrUnsupported)
 }
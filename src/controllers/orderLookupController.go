@@ -0,0 +1,186 @@
+package controllers
+
+import (
+	"ambassador/src/checkouts"
+	"ambassador/src/database"
+	"ambassador/src/invoices"
+	"ambassador/src/models"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// orderSessionCookie holds the session started by opening an order link.
+const orderSessionCookie = "order_session"
+
+type OrderLookupRequest struct {
+	Email     string `json:"email"`
+	Reference string `json:"reference"`
+}
+
+// LookupOrder emails a one-time link to view an order when the email and
+// order reference match. The response is the same whether or not they do,
+// so the endpoint cannot be used to discover orders.
+func LookupOrder(c *fiber.Ctx) error {
+	var request OrderLookupRequest
+
+	// Parse and validate the request body
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	email := strings.TrimSpace(request.Email)
+	orderId, err := strconv.ParseUint(strings.TrimPrefix(strings.TrimSpace(request.Reference), "#"), 10, 64)
+	if email == "" || err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Email and order reference are required",
+		})
+	}
+
+	// Limit how many links can be sent to one address
+	if err := checkouts.AllowLookup(c.Context(), email); err != nil {
+		if errors.Is(err, checkouts.ErrLookupRateLimited) {
+			return c.Status(fiber.StatusTooManyRequests).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		log.Printf("Failed to count order lookups: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to look up order",
+		})
+	}
+
+	// Fetch the order placed with this email
+	var order models.Order
+	err = database.DB.Where("id = ? AND LOWER(email) = ?", orderId, strings.ToLower(email)).First(&order).Error
+	if err != nil && !errors.Is(err, gorm.ErrRecordNotFound) {
+		log.Printf("Failed to fetch order: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to look up order",
+		})
+	}
+
+	if err == nil {
+		if err := checkouts.SendLookupLink(c.Context(), order); err != nil {
+			log.Printf("Failed to send order link for order %d: %v", order.Id, err)
+		}
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(fiber.Map{
+		"message": "If an order matches, a link to view it has been sent to your email",
+	})
+}
+
+// OpenOrderLink exchanges a one-time order link for a viewing session and
+// returns the order.
+func OpenOrderLink(c *fiber.Ctx) error {
+	var data map[string]string
+
+	// Parse the request body
+	if err := c.BodyParser(&data); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	session, orderId, err := checkouts.OpenLookupLink(c.Context(), data["token"])
+	if err != nil {
+		if errors.Is(err, checkouts.ErrInvalidLookupToken) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		log.Printf("Failed to open order link: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to open order link",
+		})
+	}
+
+	// Keep the session in a cookie so the page can be reloaded
+	expires := time.Now().Add(checkouts.LookupSessionTTL)
+	c.Cookie(&fiber.Cookie{
+		Name:     orderSessionCookie,
+		Value:    session,
+		Expires:  expires,
+		HTTPOnly: true,
+	})
+
+	return customerOrder(c, orderId, expires)
+}
+
+// ViewOrder returns the order of the current viewing session.
+func ViewOrder(c *fiber.Ctx) error {
+	orderId, expires, err := checkouts.LookupSession(c.Context(), c.Cookies(orderSessionCookie))
+	if err != nil {
+		if errors.Is(err, checkouts.ErrInvalidLookupToken) {
+			return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+				"message": "Your order session has expired, please request a new link",
+			})
+		}
+		log.Printf("Failed to look up order session: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch order",
+		})
+	}
+
+	return customerOrder(c, orderId, expires)
+}
+
+// customerOrder returns the parts of an order shown to its customer. The
+// invoice link expires together with the viewing session.
+func customerOrder(c *fiber.Ctx, orderId uint, expires time.Time) error {
+	var order models.Order
+	if err := database.DB.Preload("OrderItems").First(&order, orderId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Order not found",
+			})
+		}
+		log.Printf("Failed to fetch order: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch order",
+		})
+	}
+
+	items := make([]fiber.Map, 0, len(order.OrderItems))
+	for _, item := range order.OrderItems {
+		items = append(items, fiber.Map{
+			"title":    item.ProductTitle,
+			"price":    item.Price,
+			"quantity": item.Quantity,
+			"discount": item.Discount,
+			"tax":      item.Tax,
+			"total":    item.GetTotal(),
+		})
+	}
+
+	var invoiceURL interface{}
+	if isConfirmed(order.Status) {
+		invoiceURL = invoices.SignedURL(order.Id, expires)
+	}
+
+	return c.JSON(fiber.Map{
+		"order": fiber.Map{
+			"id":           order.Id,
+			"status":       order.Status,
+			"currency":     order.Currency,
+			"created_at":   order.CreatedAt,
+			"completed_at": order.CompletedAt,
+			"items":        items,
+			"subtotal":     order.GetTotal(),
+			"discount":     order.Discount,
+			"tax":          order.Tax,
+			"shipping":     order.Shipping,
+			"total":        order.GetChargedTotal(),
+			"refunded":     order.RefundedAmount,
+		},
+		"invoice_url": invoiceURL,
+		"expires_at":  expires,
+	})
+}
@@ -0,0 +1,142 @@
+package controllers
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"ambassador/src/outbox"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"strconv"
+)
+
+// OutboxEvents lists outbox events newest first, optionally filtered by
+// status (pending, delivered or dead) and type.
+func OutboxEvents(c *fiber.Ctx) error {
+	page := c.QueryInt("page", 1)
+	if page <= 0 {
+		page = 1
+	}
+	perPage := c.QueryInt("per_page", 50)
+	if perPage <= 0 || perPage > 200 {
+		perPage = 50
+	}
+
+	query := database.DB.Model(&models.OutboxEvent{})
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+	if eventType := c.Query("type"); eventType != "" {
+		query = query.Where("type = ?", eventType)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Failed to count outbox events: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch outbox events",
+		})
+	}
+
+	var events []models.OutboxEvent
+	if err := query.Order("id DESC").Offset((page - 1) * perPage).Limit(perPage).Find(&events).Error; err != nil {
+		log.Printf("Failed to fetch outbox events: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch outbox events",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": events,
+		"meta": fiber.Map{
+			"total":     total,
+			"page":      page,
+			"last_page": (total + int64(perPage) - 1) / int64(perPage),
+		},
+	})
+}
+
+// GetOutboxEvent returns a single outbox event with its last error.
+func GetOutboxEvent(c *fiber.Ctx) error {
+	event, err := fetchOutboxEvent(c)
+	if err != nil {
+		return outboxLookupError(c, err)
+	}
+
+	return c.JSON(fiber.Map{
+		"event":        event,
+		"max_attempts": outbox.MaxAttempts,
+	})
+}
+
+// ReplayOutboxEvent schedules a dead event to be tried again now.
+func ReplayOutboxEvent(c *fiber.Ctx) error {
+	event, err := fetchOutboxEvent(c)
+	if err != nil {
+		return outboxLookupError(c, err)
+	}
+
+	if err := outbox.Replay(&event); err != nil {
+		if errors.Is(err, outbox.ErrNotReplayable) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		log.Printf("Failed to replay outbox event %d: %v", event.Id, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to replay outbox event",
+		})
+	}
+
+	return c.JSON(event)
+}
+
+// ReplayDeadOutboxEvents schedules every dead event, optionally of one type,
+// to be tried again.
+func ReplayDeadOutboxEvents(c *fiber.Ctx) error {
+	replayed, err := outbox.ReplayDead(c.Query("type"))
+	if err != nil {
+		log.Printf("Failed to replay dead outbox events: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to replay outbox events",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"replayed": replayed,
+	})
+}
+
+var errInvalidOutboxEventId = errors.New("invalid outbox event ID")
+
+// fetchOutboxEvent loads the outbox event in the :id parameter.
+func fetchOutboxEvent(c *fiber.Ctx) (models.OutboxEvent, error) {
+	var event models.OutboxEvent
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return event, errInvalidOutboxEventId
+	}
+
+	err = database.DB.First(&event, id).Error
+	return event, err
+}
+
+func outboxLookupError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errInvalidOutboxEventId) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid outbox event ID",
+		})
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": "Outbox event not found",
+		})
+	}
+
+	log.Printf("Failed to fetch outbox event: %v", err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"message": "Failed to fetch outbox event",
+	})
+}
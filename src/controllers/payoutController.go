@@ -0,0 +1,106 @@
+package controllers
+
+import (
+	"ambassador/src/currency"
+	"ambassador/src/database"
+	"ambassador/src/middlewares"
+	"ambassador/src/models"
+	"ambassador/src/payouts"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"time"
+)
+
+// PayoutRequest defines the request body for recording a payout.
+type PayoutRequest struct {
+	UserId    uint       `json:"user_id"`
+	Amount    float64    `json:"amount"`
+	Currency  string     `json:"currency"`
+	Reference string     `json:"reference"`
+	PaidAt    *time.Time `json:"paid_at"`
+}
+
+// Payouts returns every payout, newest first. Pass user_id for the payouts
+// of one ambassador.
+func Payouts(c *fiber.Ctx) error {
+	query := database.DB.Order("id DESC")
+	if userId := c.QueryInt("user_id"); userId > 0 {
+		query = query.Where("user_id = ?", userId)
+	}
+
+	var list []models.Payout
+	if err := query.Find(&list).Error; err != nil {
+		log.Printf("Failed to fetch payouts: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch payouts",
+		})
+	}
+
+	return c.JSON(list)
+}
+
+// RecordPayout records commission paid out to an ambassador outside the app
+// and lets them know through the channels they chose.
+func RecordPayout(c *fiber.Ctx) error {
+	adminId, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var request PayoutRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	payout := models.Payout{
+		UserId:    request.UserId,
+		Amount:    request.Amount,
+		Currency:  request.Currency,
+		Reference: request.Reference,
+		Actor:     models.ActorAdmin(adminId),
+	}
+	if request.PaidAt != nil {
+		payout.PaidAt = *request.PaidAt
+	}
+
+	if err := payouts.Record(&payout); err != nil {
+		switch {
+		case errors.Is(err, payouts.ErrInvalidAmount), errors.Is(err, payouts.ErrNotAmbassador),
+			errors.Is(err, currency.ErrInvalid), errors.Is(err, currency.ErrZeroDecimal):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		log.Printf("Failed to record payout: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to record payout",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(payout)
+}
+
+// AmbassadorPayouts returns the payouts of the signed-in ambassador, newest first.
+func AmbassadorPayouts(c *fiber.Ctx) error {
+	userId, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var list []models.Payout
+	if err := database.DB.Where("user_id = ?", userId).Order("id DESC").Find(&list).Error; err != nil {
+		log.Printf("Failed to fetch payouts: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch payouts",
+		})
+	}
+
+	return c.JSON(list)
+}
@@ -0,0 +1,147 @@
+package controllers
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"strconv"
+	"strings"
+)
+
+// TaxRates returns all configured tax rates.
+func TaxRates(c *fiber.Ctx) error {
+	var rates []models.TaxRate
+	if err := database.DB.Order("country, region").Find(&rates).Error; err != nil {
+		log.Printf("Failed to fetch tax rates: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch tax rates",
+		})
+	}
+	return c.JSON(rates)
+}
+
+// CreateTaxRate adds a tax rate for a country or one of its regions.
+func CreateTaxRate(c *fiber.Ctx) error {
+	var rate models.TaxRate
+	if err := c.BodyParser(&rate); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	// Validate the rate
+	rate.Id = 0
+	rate.Country = strings.ToUpper(strings.TrimSpace(rate.Country))
+	rate.Region = strings.TrimSpace(rate.Region)
+	if len(rate.Country) != 2 || rate.Rate < 0 || rate.Rate >= 1 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Country must be a two-letter code and rate a fraction between 0 and 1",
+		})
+	}
+
+	if err := database.DB.Create(&rate).Error; err != nil {
+		return pricingSaveError(c, err, "Tax rate")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(rate)
+}
+
+// DeleteTaxRate removes a tax rate by ID.
+func DeleteTaxRate(c *fiber.Ctx) error {
+	return deletePricingRecord(c, &models.TaxRate{}, "Tax rate")
+}
+
+// ShippingRules returns all configured shipping rules.
+func ShippingRules(c *fiber.Ctx) error {
+	var rules []models.ShippingRule
+	if err := database.DB.Order("country").Find(&rules).Error; err != nil {
+		log.Printf("Failed to fetch shipping rules: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch shipping rules",
+		})
+	}
+	return c.JSON(rules)
+}
+
+// CreateShippingRule adds the shipping rule of a country, or the catch-all
+// rule when no country is given.
+func CreateShippingRule(c *fiber.Ctx) error {
+	var rule models.ShippingRule
+	if err := c.BodyParser(&rule); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	// Validate the rule
+	rule.Id = 0
+	rule.Country = strings.ToUpper(strings.TrimSpace(rule.Country))
+	if rule.Country != "" && len(rule.Country) != 2 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Country must be a two-letter code or empty",
+		})
+	}
+	if rule.Type != models.ShippingFlat && rule.Type != models.ShippingWeight {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Type must be flat or weight",
+		})
+	}
+	if rule.Amount < 0 || rule.PerKg < 0 || rule.FreeOver < 0 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Amounts must not be negative",
+		})
+	}
+
+	if err := database.DB.Create(&rule).Error; err != nil {
+		return pricingSaveError(c, err, "Shipping rule")
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(rule)
+}
+
+// DeleteShippingRule removes a shipping rule by ID.
+func DeleteShippingRule(c *fiber.Ctx) error {
+	return deletePricingRecord(c, &models.ShippingRule{}, "Shipping rule")
+}
+
+func deletePricingRecord(c *fiber.Ctx, record interface{}, name string) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid " + strings.ToLower(name) + " ID",
+		})
+	}
+
+	result := database.DB.Delete(record, id)
+	if result.Error != nil {
+		log.Printf("Failed to delete %s: %v", strings.ToLower(name), result.Error)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to delete " + strings.ToLower(name),
+		})
+	}
+	if result.RowsAffected == 0 {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": name + " not found",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"message": name + " deleted successfully",
+	})
+}
+
+func pricingSaveError(c *fiber.Ctx, err error, name string) error {
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": name + " already exists for this destination",
+		})
+	}
+
+	log.Printf("Failed to save %s: %v", strings.ToLower(name), err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"message": "Failed to save " + strings.ToLower(name),
+	})
+}
@@ -38,6 +38,9 @@ func CreateProduct(c *fiber.Ctx) error {
 		})
 	}
 
+	// Currency prices are managed through their own endpoints
+	product.Prices = nil
+
 	// Validate required fields
 	if product.Title == "" || product.Description == "" || product.Image == "" || product.Price <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -70,9 +73,9 @@ func GetProduct(c *fiber.Ctx) error {
 		})
 	}
 
-	// Fetch the product from the database
+	// Fetch the product and its currency prices from the database
 	var product models.Product
-	if err := database.DB.First(&product, id).Error; err != nil {
+	if err := database.DB.Preload("Prices").First(&product, id).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
 				"message": "Product not found",
@@ -112,8 +115,14 @@ func DeleteProduct(c *fiber.Ctx) error {
 		})
 	}
 
-	// Delete the product from the database
-	if err := database.DB.Delete(&product).Error; err != nil {
+	// Delete the product and its currency prices from the database
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("product_id = ?", product.Id).Delete(&models.ProductPrice{}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&product).Error
+	})
+	if err != nil {
 		log.Printf("Failed to delete product: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
 			"message": "Failed to delete product",
@@ -147,6 +156,9 @@ func UpdateProduct(c *fiber.Ctx) error {
 		})
 	}
 
+	// Currency prices are managed through their own endpoints
+	product.Prices = nil
+
 	// Validate required fields
 	if product.Title == "" || product.Description == "" || product.Image == "" || product.Price <= 0 {
 		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/middlewares"
+	"ambassador/src/models"
+	"ambassador/src/refunds"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/webhook"
+	"gorm.io/gorm"
+	"log"
+	"os"
+	"strconv"
+)
+
+// RefundOrderRequest defines the request body for refunding an order.
+// Leaving items empty refunds everything that has not been refunded yet.
+type RefundOrderRequest struct {
+	Items  []refunds.ItemRequest `json:"items"`
+	Reason string                `json:"reason"`
+}
+
+// RefundOrder issues a full or partial refund for an order through Stripe.
+func RefundOrder(c *fiber.Ctx) error {
+	adminId, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid order ID",
+		})
+	}
+
+	var request RefundOrderRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	// Fetch the order with its items
+	var order models.Order
+	if err := database.DB.Preload("OrderItems").First(&order, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+				"message": "Order not found",
+			})
+		}
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch order",
+		})
+	}
+
+	refund, err := refunds.Issue(&order, request.Items, request.Reason, models.ActorAdmin(adminId))
+	if err != nil {
+		var stripeErr *stripe.Error
+		switch {
+		case errors.Is(err, refunds.ErrNotRefundable), errors.Is(err, refunds.ErrNothingToRefund):
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		case errors.Is(err, refunds.ErrInvalidItem), errors.Is(err, refunds.ErrInvalidQuantity):
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		case errors.As(err, &stripeErr):
+			return c.Status(fiber.StatusBadGateway).JSON(fiber.Map{
+				"message": stripeErr.Msg,
+			})
+		}
+		log.Printf("Failed to refund order %d: %v", order.Id, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to refund order",
+		})
+	}
+
+	// Revenue changed, so the cached ambassador revenue is stale
+	go database.ClearCache("ambassadors_with_revenue")
+
+	return c.Status(fiber.StatusCreated).JSON(refund)
+}
+
+// OrderRefunds lists the refunds of an order.
+func OrderRefunds(c *fiber.Ctx) error {
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid order ID",
+		})
+	}
+
+	var refundList []models.Refund
+	if err := database.DB.Preload("RefundItems").Where("order_id = ?", id).Order("id").Find(&refundList).Error; err != nil {
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch refunds",
+		})
+	}
+
+	return c.JSON(refundList)
+}
+
+// StripeWebhook handles events sent by Stripe. Refunds issued from the Stripe
+// dashboard are applied the same way as refunds issued through the API.
+func StripeWebhook(c *fiber.Ctx) error {
+	event, err := webhook.ConstructEventWithOptions(c.Body(), c.Get("Stripe-Signature"), os.Getenv("STRIPE_WEBHOOK_SECRET"),
+		webhook.ConstructEventOptions{IgnoreAPIVersionMismatch: true})
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid signature",
+		})
+	}
+
+	switch event.Type {
+	case "charge.refunded":
+		var charge stripe.Charge
+		if err := charge.UnmarshalJSON(event.Data.Raw); err != nil || charge.PaymentIntent == nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": "Invalid charge payload",
+			})
+		}
+
+		if err := refunds.SyncPaymentIntent(charge.PaymentIntent.ID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				// Not one of our orders; acknowledge so Stripe stops retrying
+				return c.JSON(fiber.Map{"message": "ignored"})
+			}
+			log.Printf("Failed to sync refunds for %s: %v", charge.PaymentIntent.ID, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to process refund",
+			})
+		}
+
+		go database.ClearCache("ambassadors_with_revenue")
+	}
+
+	return c.JSON(fiber.Map{
+		"message": "success",
+	})
+}
@@ -2,11 +2,12 @@ package controllers
 
 import (
 	"ambassador/src/database"
+	"ambassador/src/middlewares"
 	"ambassador/src/models"
+	"ambassador/src/rankings"
 	"context"
 	"encoding/json"
 	"github.com/gofiber/fiber/v2"
-	"github.com/redis/go-redis/v9"
 	"log"
 	"time"
 )
@@ -66,7 +67,7 @@ func fetchAndCalculateRevenue(users *[]models.User) error {
 
 	// Fetch all completed orders and order items for ambassadors
 	var orders []models.Order
-	if err := database.DB.Preload("OrderItems").Where("user_id IN (SELECT id FROM users WHERE is_ambassador = ?)", true).Find(&orders).Error; err != nil {
+	if err := database.DB.Preload("OrderItems").Where("user_id IN (SELECT id FROM users WHERE is_ambassador = ?) AND status IN ?", true, models.RevenueStatuses).Find(&orders).Error; err != nil {
 		return err
 	}
 
@@ -79,31 +80,37 @@ func fetchAndCalculateRevenue(users *[]models.User) error {
 	// Calculate revenue for each ambassador
 	for i, user := range *users {
 		ambassador := models.Ambassador(user)
-		if orders, ok := orderMap[ambassador.Id]; ok {
-			revenue := 0.0
-			for _, order := range orders {
-				for _, orderItem := range order.OrderItems {
-					revenue += orderItem.AmbassadorRevenue
-				}
-			}
-			ambassador.Revenue = &revenue
-		} else {
-			revenue := 0.0
-			ambassador.Revenue = &revenue
-		}
+		ambassador.SetRevenue(orderMap[ambassador.Id])
 		(*users)[i] = models.User(ambassador)
 	}
 
 	return nil
 }
 
-// Rankings returns the rankings of ambassadors based on their revenue.
+// Rankings returns a page of the ambassador leaderboard for a window
+// (day, week, month or all), ordered by revenue with rank positions.
 func Rankings(c *fiber.Ctx) error {
-	rankings, err := database.Cache.ZRevRangeByScoreWithScores(context.Background(), "rankings", &redis.ZRangeBy{
-		Min: "-inf",
-		Max: "+inf",
-	}).Result()
+	ctx := context.Background()
+
+	window := c.Query("window", rankings.WindowAll)
+	if !rankings.ValidWindow(window) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Window must be day, week, month or all",
+		})
+	}
 
+	page := c.QueryInt("page", 1)
+	if page <= 0 {
+		page = 1
+	}
+	perPage := c.QueryInt("per_page", 20)
+	if perPage <= 0 || perPage > 100 {
+		perPage = 20
+	}
+
+	// Fetch the requested page from the leaderboard
+	now := time.Now()
+	entries, total, err := rankings.Page(ctx, rankings.Key(window, now), page, perPage)
 	if err != nil {
 		log.Printf("Failed to fetch rankings: %v", err)
 		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
@@ -111,11 +118,96 @@ func Rankings(c *fiber.Ctx) error {
 		})
 	}
 
-	result := make(map[string]float64)
+	// Resolve the display names of the ranked ambassadors in one query
+	ids := make([]uint, len(entries))
+	for i, entry := range entries {
+		ids[i] = entry.UserId
+	}
+
+	var users []models.User
+	if len(ids) > 0 {
+		if err := database.DB.Where("id IN ?", ids).Find(&users).Error; err != nil {
+			log.Printf("Failed to fetch ranked users: %v", err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to fetch rankings",
+			})
+		}
+	}
+
+	names := make(map[uint]string, len(users))
+	for _, user := range users {
+		names[user.Id] = user.Name()
+	}
+
+	data := make([]fiber.Map, 0, len(entries))
+	for _, entry := range entries {
+		data = append(data, fiber.Map{
+			"rank":    entry.Rank,
+			"user_id": entry.UserId,
+			"name":    names[entry.UserId],
+			"revenue": entry.Revenue,
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"window": window,
+		"period": rankings.Period(window, now),
+		"data":   data,
+		"meta": fiber.Map{
+			"total":     total,
+			"page":      page,
+			"last_page": (total + int64(perPage) - 1) / int64(perPage),
+		},
+	})
+}
+
+// MyRanking returns the authenticated ambassador's position in a leaderboard window.
+func MyRanking(c *fiber.Ctx) error {
+	id, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	window := c.Query("window", rankings.WindowAll)
+	if !rankings.ValidWindow(window) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Window must be day, week, month or all",
+		})
+	}
+
+	ctx := context.Background()
+	now := time.Now()
+	key := rankings.Key(window, now)
+
+	entry, err := rankings.Position(ctx, key, id)
+	if err != nil {
+		log.Printf("Failed to fetch ranking position: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch ranking",
+		})
+	}
+
+	total, err := database.Cache.ZCard(ctx, key).Result()
+	if err != nil {
+		log.Printf("Failed to count rankings: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch ranking",
+		})
+	}
 
-	for _, ranking := range rankings {
-		result[ranking.Member.(string)] = ranking.Score
+	// A rank of zero means the ambassador has no sales in the window
+	var rank interface{} = entry.Rank
+	if entry.Rank == 0 {
+		rank = nil
 	}
 
-	return c.JSON(result)
+	return c.JSON(fiber.Map{
+		"window":  window,
+		"period":  rankings.Period(window, now),
+		"rank":    rank,
+		"revenue": entry.Revenue,
+		"total":   total,
+	})
 }
@@ -0,0 +1,392 @@
+package controllers
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/middlewares"
+	"ambassador/src/models"
+	"ambassador/src/webhooks"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"log"
+	"strconv"
+	"strings"
+)
+
+type WebhookEndpointRequest struct {
+	URL         string   `json:"url"`
+	Description string   `json:"description"`
+	Events      []string `json:"events"`
+	Active      *bool    `json:"active"`
+	UserId      uint     `json:"user_id"` // admins only; zero subscribes a partner to every ambassador
+}
+
+// WebhookEvents lists the event types endpoints can subscribe to.
+func WebhookEvents(c *fiber.Ctx) error {
+	return c.JSON(webhooks.Events)
+}
+
+// WebhookEndpoints lists the endpoints the user manages: their own for
+// ambassadors, every endpoint for admins.
+func WebhookEndpoints(c *fiber.Ctx) error {
+	query, err := webhookEndpointScope(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var endpoints []models.WebhookEndpoint
+	if err := query.Order("id").Find(&endpoints).Error; err != nil {
+		log.Printf("Failed to fetch webhook endpoints: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch webhook endpoints",
+		})
+	}
+
+	return c.JSON(endpoints)
+}
+
+// CreateWebhookEndpoint registers a URL for a set of events. The signing
+// secret is only returned here and when it is rotated.
+func CreateWebhookEndpoint(c *fiber.Ctx) error {
+	id, err := middlewares.GetUserId(c)
+	if err != nil {
+		return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
+			"message": "Unauthorized",
+		})
+	}
+
+	var request WebhookEndpointRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	// Validate the URL and the event filter
+	if err := webhooks.ValidateURL(request.URL); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+	events, err := webhooks.NormalizeEvents(request.Events)
+	if err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": err.Error(),
+		})
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err != nil {
+		log.Printf("Failed to generate webhook secret: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to create webhook endpoint",
+		})
+	}
+
+	// Ambassadors always subscribe to their own events
+	owner := id
+	if isAdminRequest(c) {
+		owner = request.UserId
+	}
+
+	endpoint := models.WebhookEndpoint{
+		UserId:      owner,
+		URL:         request.URL,
+		Description: truncate(request.Description, 255),
+		Events:      events,
+		Secret:      secret,
+		Active:      true,
+	}
+	if err := database.DB.Create(&endpoint).Error; err != nil {
+		log.Printf("Failed to create webhook endpoint: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to create webhook endpoint",
+		})
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(fiber.Map{
+		"endpoint": endpoint,
+		"secret":   secret,
+	})
+}
+
+// GetWebhookEndpoint returns an endpoint with its subscriptions.
+func GetWebhookEndpoint(c *fiber.Ctx) error {
+	endpoint, err := fetchWebhookEndpoint(c)
+	if err != nil {
+		return webhookLookupError(c, err, "Webhook endpoint")
+	}
+
+	return c.JSON(endpoint)
+}
+
+// UpdateWebhookEndpoint changes the URL, description or events of an
+// endpoint. Setting active to true re-enables an endpoint that was disabled
+// after repeated failures.
+func UpdateWebhookEndpoint(c *fiber.Ctx) error {
+	endpoint, err := fetchWebhookEndpoint(c)
+	if err != nil {
+		return webhookLookupError(c, err, "Webhook endpoint")
+	}
+
+	var request WebhookEndpointRequest
+	if err := c.BodyParser(&request); err != nil {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid request body",
+		})
+	}
+
+	updates := map[string]interface{}{}
+	if request.URL != "" {
+		if err := webhooks.ValidateURL(request.URL); err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		updates["url"] = request.URL
+	}
+	if request.Description != "" {
+		updates["description"] = truncate(request.Description, 255)
+	}
+	if request.Events != nil {
+		events, err := webhooks.NormalizeEvents(request.Events)
+		if err != nil {
+			return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+				"message": err.Error(),
+			})
+		}
+		updates["events"] = events
+	}
+	if request.Active != nil {
+		updates["active"] = *request.Active
+		if *request.Active {
+			updates["consecutive_failures"] = 0
+			updates["disabled_at"] = nil
+			updates["disabled_reason"] = ""
+		}
+	}
+
+	if len(updates) > 0 {
+		if err := database.DB.Model(&endpoint).Updates(updates).Error; err != nil {
+			log.Printf("Failed to update webhook endpoint %d: %v", endpoint.Id, err)
+			return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+				"message": "Failed to update webhook endpoint",
+			})
+		}
+	}
+
+	// Return the stored endpoint
+	if err := database.DB.First(&endpoint, endpoint.Id).Error; err != nil {
+		return webhookLookupError(c, err, "Webhook endpoint")
+	}
+	return c.JSON(endpoint)
+}
+
+// DeleteWebhookEndpoint removes an endpoint and cancels its pending deliveries.
+func DeleteWebhookEndpoint(c *fiber.Ctx) error {
+	endpoint, err := fetchWebhookEndpoint(c)
+	if err != nil {
+		return webhookLookupError(c, err, "Webhook endpoint")
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&models.WebhookDelivery{}).
+			Where("endpoint_id = ? AND status = ?", endpoint.Id, models.WebhookPending).
+			Updates(map[string]interface{}{"status": models.WebhookFailed, "last_error": "endpoint was deleted"}).Error; err != nil {
+			return err
+		}
+		return tx.Delete(&endpoint).Error
+	})
+	if err != nil {
+		log.Printf("Failed to delete webhook endpoint %d: %v", endpoint.Id, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to delete webhook endpoint",
+		})
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RotateWebhookSecret replaces the signing secret of an endpoint.
+func RotateWebhookSecret(c *fiber.Ctx) error {
+	endpoint, err := fetchWebhookEndpoint(c)
+	if err != nil {
+		return webhookLookupError(c, err, "Webhook endpoint")
+	}
+
+	secret, err := webhooks.NewSecret()
+	if err == nil {
+		err = database.DB.Model(&endpoint).Update("secret", secret).Error
+	}
+	if err != nil {
+		log.Printf("Failed to rotate secret of webhook endpoint %d: %v", endpoint.Id, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to rotate webhook secret",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"secret": secret,
+	})
+}
+
+// WebhookDeliveries lists the deliveries of an endpoint newest first,
+// optionally filtered by status.
+func WebhookDeliveries(c *fiber.Ctx) error {
+	endpoint, err := fetchWebhookEndpoint(c)
+	if err != nil {
+		return webhookLookupError(c, err, "Webhook endpoint")
+	}
+
+	page := c.QueryInt("page", 1)
+	if page <= 0 {
+		page = 1
+	}
+	perPage := c.QueryInt("per_page", 50)
+	if perPage <= 0 || perPage > 200 {
+		perPage = 50
+	}
+
+	query := database.DB.Model(&models.WebhookDelivery{}).Where("endpoint_id = ?", endpoint.Id)
+	if status := c.Query("status"); status != "" {
+		query = query.Where("status = ?", status)
+	}
+
+	var total int64
+	if err := query.Count(&total).Error; err != nil {
+		log.Printf("Failed to count webhook deliveries: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch webhook deliveries",
+		})
+	}
+
+	var deliveries []models.WebhookDelivery
+	if err := query.Order("id DESC").Offset((page - 1) * perPage).Limit(perPage).Find(&deliveries).Error; err != nil {
+		log.Printf("Failed to fetch webhook deliveries: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to fetch webhook deliveries",
+		})
+	}
+
+	return c.JSON(fiber.Map{
+		"data": deliveries,
+		"meta": fiber.Map{
+			"total":     total,
+			"page":      page,
+			"last_page": (total + int64(perPage) - 1) / int64(perPage),
+		},
+	})
+}
+
+// GetWebhookDelivery returns a delivery with the log of its attempts.
+func GetWebhookDelivery(c *fiber.Ctx) error {
+	delivery, err := fetchWebhookDelivery(c)
+	if err != nil {
+		return webhookLookupError(c, err, "Webhook delivery")
+	}
+
+	return c.JSON(delivery)
+}
+
+// RedeliverWebhook sends a delivery again, whatever its outcome was.
+func RedeliverWebhook(c *fiber.Ctx) error {
+	delivery, err := fetchWebhookDelivery(c)
+	if err != nil {
+		return webhookLookupError(c, err, "Webhook delivery")
+	}
+
+	if err := webhooks.Redeliver(&delivery); err != nil {
+		if errors.Is(err, webhooks.ErrEndpointDisabled) {
+			return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+				"message": "Webhook endpoint is disabled, enable it before redelivering",
+			})
+		}
+		log.Printf("Failed to redeliver webhook delivery %d: %v", delivery.Id, err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to redeliver webhook",
+		})
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(delivery)
+}
+
+var errInvalidWebhookId = errors.New("invalid webhook ID")
+
+// isAdminRequest reports whether the request came through the admin routes.
+func isAdminRequest(c *fiber.Ctx) bool {
+	return strings.Contains(c.Path(), "/api/admin")
+}
+
+// webhookEndpointScope returns a query over the endpoints the user manages.
+func webhookEndpointScope(c *fiber.Ctx) (*gorm.DB, error) {
+	if isAdminRequest(c) {
+		return database.DB.Model(&models.WebhookEndpoint{}), nil
+	}
+
+	id, err := middlewares.GetUserId(c)
+	if err != nil {
+		return nil, err
+	}
+	return database.DB.Model(&models.WebhookEndpoint{}).Where("user_id = ?", id), nil
+}
+
+// fetchWebhookEndpoint loads the endpoint in the :id parameter if the user
+// manages it.
+func fetchWebhookEndpoint(c *fiber.Ctx) (models.WebhookEndpoint, error) {
+	var endpoint models.WebhookEndpoint
+
+	id, err := strconv.Atoi(c.Params("id"))
+	if err != nil {
+		return endpoint, errInvalidWebhookId
+	}
+
+	query, err := webhookEndpointScope(c)
+	if err != nil {
+		return endpoint, err
+	}
+
+	err = query.First(&endpoint, id).Error
+	return endpoint, err
+}
+
+// fetchWebhookDelivery loads the delivery in the :delivery parameter with its
+// attempts, if it belongs to the endpoint in the :id parameter.
+func fetchWebhookDelivery(c *fiber.Ctx) (models.WebhookDelivery, error) {
+	var delivery models.WebhookDelivery
+
+	endpoint, err := fetchWebhookEndpoint(c)
+	if err != nil {
+		return delivery, err
+	}
+
+	id, err := strconv.Atoi(c.Params("delivery"))
+	if err != nil {
+		return delivery, errInvalidWebhookId
+	}
+
+	err = database.DB.
+		Preload("Log", func(db *gorm.DB) *gorm.DB { return db.Order("id") }).
+		Where("endpoint_id = ?", endpoint.Id).
+		First(&delivery, id).Error
+	return delivery, err
+}
+
+func webhookLookupError(c *fiber.Ctx, err error, resource string) error {
+	if errors.Is(err, errInvalidWebhookId) {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Invalid " + strings.ToLower(resource) + " ID",
+		})
+	}
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return c.Status(fiber.StatusNotFound).JSON(fiber.Map{
+			"message": resource + " not found",
+		})
+	}
+
+	log.Printf("Failed to fetch %s: %v", strings.ToLower(resource), err)
+	return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+		"message": "Failed to fetch " + strings.ToLower(resource),
+	})
+}
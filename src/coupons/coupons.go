@@ -0,0 +1,233 @@
+package coupons
+
+import (
+	"ambassador/src/currency"
+	"ambassador/src/models"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"math"
+	"strings"
+	"time"
+)
+
+var (
+	ErrNotFound       = errors.New("coupon not found")
+	ErrInactive       = errors.New("coupon is not active")
+	ErrNotStarted     = errors.New("coupon is not valid yet")
+	ErrExpired        = errors.New("coupon has expired")
+	ErrExhausted      = errors.New("coupon has reached its usage limit")
+	ErrCustomerLimit  = errors.New("coupon was already used the maximum number of times by this customer")
+	ErrWrongLink      = errors.New("coupon is not valid for this link")
+	ErrNotApplicable  = errors.New("coupon does not apply to any product in the cart")
+	ErrInvalidCoupon  = errors.New("coupon type must be percentage or fixed with a positive value, percentages at most 100")
+	ErrInvalidScope   = errors.New("coupon scope must be cart or product, and product coupons need products")
+	ErrInvalidWindow  = errors.New("coupon end date must be after its start date")
+	ErrInvalidCodeLen = errors.New("coupon code must be between 3 and 64 characters")
+)
+
+// countedStatuses are the order statuses whose redemptions use up a coupon.
+var countedStatuses = []string{
+	models.OrderPending, models.OrderPaid, models.OrderPartiallyRefunded, models.OrderRefunded,
+}
+
+// Line is a cart line the coupon may discount.
+type Line struct {
+	ProductId uint
+	Price     float64
+	Quantity  uint
+}
+
+// Total returns the undiscounted line total.
+func (l Line) Total() float64 {
+	return l.Price * float64(l.Quantity)
+}
+
+// Normalize cleans up a coupon's fields before it is saved and checks them.
+func Normalize(coupon *models.Coupon) error {
+	coupon.Code = strings.ToUpper(strings.TrimSpace(coupon.Code))
+	if len(coupon.Code) < 3 || len(coupon.Code) > 64 {
+		return ErrInvalidCodeLen
+	}
+
+	if coupon.Value <= 0 ||
+		(coupon.Type != models.CouponPercentage && coupon.Type != models.CouponFixed) ||
+		(coupon.Type == models.CouponPercentage && coupon.Value > 100) {
+		return ErrInvalidCoupon
+	}
+
+	if coupon.Scope == "" {
+		coupon.Scope = models.CouponScopeCart
+	}
+	if coupon.Scope != models.CouponScopeCart && coupon.Scope != models.CouponScopeProduct {
+		return ErrInvalidScope
+	}
+	if coupon.Scope == models.CouponScopeProduct && len(coupon.Products) == 0 {
+		return ErrInvalidScope
+	}
+
+	if coupon.StartsAt != nil && coupon.EndsAt != nil && !coupon.EndsAt.After(*coupon.StartsAt) {
+		return ErrInvalidWindow
+	}
+
+	return nil
+}
+
+// Redeem locks the coupon, checks that the customer may use it through the
+// link and returns the discount for each line, with lines priced in the
+// quoted currency. It must run inside the transaction that creates the order
+// so usage limits cannot be overrun.
+func Redeem(tx *gorm.DB, code string, link models.Link, email string, lines []Line, quote currency.Quote) (models.Coupon, []float64, error) {
+	var coupon models.Coupon
+
+	err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Preload("Products").
+		Where("code = ?", strings.ToUpper(strings.TrimSpace(code))).
+		First(&coupon).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return coupon, nil, ErrNotFound
+	}
+	if err != nil {
+		return coupon, nil, err
+	}
+
+	if err := checkUsable(tx, coupon, link, email); err != nil {
+		return coupon, nil, err
+	}
+
+	discounts := Discounts(coupon, lines, quote)
+	if sum(discounts) == 0 {
+		return coupon, nil, ErrNotApplicable
+	}
+
+	return coupon, discounts, nil
+}
+
+// checkUsable verifies the coupon's state, validity window, link and limits.
+func checkUsable(tx *gorm.DB, coupon models.Coupon, link models.Link, email string) error {
+	now := time.Now()
+
+	switch {
+	case !coupon.Active:
+		return ErrInactive
+	case coupon.StartsAt != nil && now.Before(*coupon.StartsAt):
+		return ErrNotStarted
+	case coupon.EndsAt != nil && !now.Before(*coupon.EndsAt):
+		return ErrExpired
+	case coupon.LinkId != nil && *coupon.LinkId != link.Id:
+		return ErrWrongLink
+	}
+
+	if coupon.MaxUses > 0 {
+		uses, err := countRedemptions(tx, coupon.Id, "")
+		if err != nil {
+			return err
+		}
+		if uses >= int64(coupon.MaxUses) {
+			return ErrExhausted
+		}
+	}
+
+	if coupon.MaxUsesPerCustomer > 0 {
+		uses, err := countRedemptions(tx, coupon.Id, email)
+		if err != nil {
+			return err
+		}
+		if uses >= int64(coupon.MaxUsesPerCustomer) {
+			return ErrCustomerLimit
+		}
+	}
+
+	return nil
+}
+
+// CountRedemptions counts redemptions on orders that were not abandoned.
+func CountRedemptions(db *gorm.DB, couponId uint) (int64, error) {
+	return countRedemptions(db, couponId, "")
+}
+
+func countRedemptions(db *gorm.DB, couponId uint, email string) (int64, error) {
+	query := db.Model(&models.CouponRedemption{}).
+		Joins("JOIN orders ON orders.id = coupon_redemptions.order_id").
+		Where("coupon_redemptions.coupon_id = ? AND orders.status IN ?", couponId, countedStatuses)
+
+	if email != "" {
+		query = query.Where("coupon_redemptions.email = ?", strings.ToLower(email))
+	}
+
+	var count int64
+	err := query.Count(&count).Error
+	return count, err
+}
+
+// Discounts returns the discount for each line, rounded to cents. Fixed
+// amounts are entered in the base currency, converted with the quote and
+// spread over the eligible lines in proportion to their totals.
+func Discounts(coupon models.Coupon, lines []Line, quote currency.Quote) []float64 {
+	discounts := make([]float64, len(lines))
+
+	// Work out which lines the coupon applies to
+	eligible := make([]bool, len(lines))
+	eligibleTotal := 0.0
+	for i, line := range lines {
+		eligible[i] = appliesTo(coupon, line.ProductId)
+		if eligible[i] {
+			eligibleTotal += line.Total()
+		}
+	}
+	if eligibleTotal == 0 {
+		return discounts
+	}
+
+	if coupon.Type == models.CouponPercentage {
+		for i, line := range lines {
+			if eligible[i] {
+				discounts[i] = roundCents(line.Total() * coupon.Value / 100)
+			}
+		}
+		return discounts
+	}
+
+	// Fixed amounts never exceed what is being bought
+	amount := math.Min(quote.FromBase(coupon.Value), eligibleTotal)
+	remaining := roundCents(amount)
+	last := -1
+
+	for i, line := range lines {
+		if !eligible[i] {
+			continue
+		}
+		discounts[i] = roundCents(amount * line.Total() / eligibleTotal)
+		remaining -= discounts[i]
+		last = i
+	}
+
+	// Put the rounding difference on the last eligible line
+	discounts[last] = roundCents(discounts[last] + remaining)
+
+	return discounts
+}
+
+func appliesTo(coupon models.Coupon, productId uint) bool {
+	if coupon.Scope != models.CouponScopeProduct {
+		return true
+	}
+	for _, product := range coupon.Products {
+		if product.Id == productId {
+			return true
+		}
+	}
+	return false
+}
+
+func sum(values []float64) float64 {
+	total := 0.0
+	for _, v := range values {
+		total += v
+	}
+	return total
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,128 @@
+package currency
+
+import (
+	"ambassador/src/models"
+	"errors"
+	"gorm.io/gorm"
+	"math"
+	"os"
+	"strings"
+)
+
+var (
+	ErrInvalid     = errors.New("currency must be a three-letter ISO 4217 code")
+	ErrZeroDecimal = errors.New("currencies without minor units are not supported")
+	ErrUnsupported = errors.New("currency has no exchange rate")
+)
+
+// zeroDecimal lists the currencies Stripe charges in whole units. Amounts are
+// stored and sent in cents, so these cannot be used.
+var zeroDecimal = map[string]bool{
+	"BIF": true, "CLP": true, "DJF": true, "GNF": true, "JPY": true, "KMF": true, "KRW": true, "MGA": true,
+	"PYG": true, "RWF": true, "UGX": true, "VND": true, "VUV": true, "XAF": true, "XOF": true, "XPF": true,
+}
+
+// Base returns the currency product prices, shipping rules and fixed coupons
+// are entered in, configured with BASE_CURRENCY.
+func Base() string {
+	if code, err := Normalize(os.Getenv("BASE_CURRENCY")); err == nil {
+		return code
+	}
+	return "USD"
+}
+
+// Reporting returns the currency revenue is reported in, configured with
+// REPORTING_CURRENCY and defaulting to the base currency.
+func Reporting() string {
+	if code, err := Normalize(os.Getenv("REPORTING_CURRENCY")); err == nil {
+		return code
+	}
+	return Base()
+}
+
+// Normalize upper-cases a currency code and checks that it can be charged.
+func Normalize(code string) (string, error) {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	if len(code) != 3 {
+		return "", ErrInvalid
+	}
+	for _, r := range code {
+		if r < 'A' || r > 'Z' {
+			return "", ErrInvalid
+		}
+	}
+	if zeroDecimal[code] {
+		return "", ErrZeroDecimal
+	}
+	return code, nil
+}
+
+// Rate returns how many units of the currency one unit of the base currency is worth.
+func Rate(db *gorm.DB, code string) (float64, error) {
+	if code == Base() {
+		return 1, nil
+	}
+
+	var rate models.ExchangeRate
+	err := db.Where("currency = ?", code).First(&rate).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) || (err == nil && rate.Rate <= 0) {
+		return 0, ErrUnsupported
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	return rate.Rate, nil
+}
+
+// Quote fixes the exchange rates used for one checkout.
+type Quote struct {
+	Currency      string
+	Rate          float64 // units of Currency per unit of the base currency
+	ReportingRate float64 // units of the reporting currency per unit of Currency
+}
+
+// NewQuote looks up the current rates of a currency.
+func NewQuote(db *gorm.DB, code string) (Quote, error) {
+	code, err := Normalize(code)
+	if err != nil {
+		return Quote{}, err
+	}
+
+	rate, err := Rate(db, code)
+	if err != nil {
+		return Quote{}, err
+	}
+	reportingRate, err := Rate(db, Reporting())
+	if err != nil {
+		return Quote{}, err
+	}
+
+	return Quote{Currency: code, Rate: rate, ReportingRate: reportingRate / rate}, nil
+}
+
+// FromBase converts an amount in the base currency, rounded to cents.
+func (q Quote) FromBase(amount float64) float64 {
+	return Round(amount * q.Rate)
+}
+
+// ToBase converts an amount back into the base currency.
+func (q Quote) ToBase(amount float64) float64 {
+	return amount / q.Rate
+}
+
+// Price returns the unit price of a product in the quoted currency, using
+// its explicit price when one is set. Prices must be preloaded.
+func (q Quote) Price(product models.Product) float64 {
+	for _, price := range product.Prices {
+		if price.Currency == q.Currency {
+			return price.Price
+		}
+	}
+	return q.FromBase(product.Price)
+}
+
+// Round rounds an amount to cents.
+func Round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -15,12 +15,12 @@ func Connect() {
 
 	// Try to connect to the database using the first connection string
 	connectionString := "root:root@tcp(db:3306)/ambassador?charset=utf8mb4&parseTime=True&loc=Local"
-	DB, err = gorm.Open(mysql.Open(connectionString), &gorm.Config{})
+	DB, err = gorm.Open(mysql.Open(connectionString), &gorm.Config{TranslateError: true})
 	if err != nil {
 		// If the first connection fails, try the fallback connection string
 		log.Printf("Failed to connect to database at 'db:3306': %v. Trying fallback...", err)
 		fallbackConnectionString := "root:root@tcp(localhost:3306)/ambassador?charset=utf8mb4&parseTime=True&loc=Local"
-		DB, err = gorm.Open(mysql.Open(fallbackConnectionString), &gorm.Config{})
+		DB, err = gorm.Open(mysql.Open(fallbackConnectionString), &gorm.Config{TranslateError: true})
 		if err != nil {
 			log.Fatalf("Failed to connect to database at 'localhost:3306': %v", err)
 		}
@@ -41,8 +41,62 @@ func Connect() {
 }
 
 func AutoMigrate() {
-	err := DB.AutoMigrate(models.User{}, models.Product{}, models.Link{}, models.Order{}, models.OrderItem{})
+	// Duplicate link codes must be resolved before the unique index is created
+	if err := reassignDuplicateLinkCodes(); err != nil {
+		log.Printf("Failed to reassign duplicate link codes: %v", err)
+	}
+
+	// Links that expired before expiry notifications existed are not reported
+	markExpiredLinks := DB.Migrator().HasTable(&models.Link{}) && !DB.Migrator().HasColumn(&models.Link{}, "ExpiryNotifiedAt")
+
+	// Orders and refunds from before the leaderboard ledger are already in Redis
+	markRanked := DB.Migrator().HasTable(&models.Order{}) && !DB.Migrator().HasColumn(&models.Order{}, "RankedAt")
+
+	err := DB.AutoMigrate(models.User{}, models.Product{}, models.ProductPrice{}, models.ExchangeRate{}, models.Link{}, models.Order{}, models.OrderItem{},
+		models.OrderStatusHistory{}, models.Refund{}, models.RefundItem{},
+		models.Coupon{}, models.CouponRedemption{}, models.TaxRate{}, models.ShippingRule{}, models.LinkEvent{}, models.Export{}, models.Invoice{}, models.OutboxEvent{},
+		models.WebhookEndpoint{}, models.WebhookDelivery{}, models.WebhookAttempt{}, models.Notification{}, models.NotificationPreference{}, models.Payout{})
 	if err != nil {
+		log.Printf("Failed to migrate database: %v", err)
 		return
 	}
+
+	// Every order needs a creation time before the migrations below use it
+	if err := migrateOrderCreatedAt(); err != nil {
+		log.Printf("Failed to migrate order creation times: %v", err)
+	}
+
+	// The status column must exist before the legacy complete flag is converted
+	if err := migrateOrderStatus(); err != nil {
+		log.Printf("Failed to migrate order status: %v", err)
+	}
+
+	// Orders converted before they had a creation time still lack a completion time
+	if err := migrateOrderCompletedAt(); err != nil {
+		log.Printf("Failed to migrate order completion times: %v", err)
+	}
+
+	if err := migrateOrderCurrency(); err != nil {
+		log.Printf("Failed to migrate order currency: %v", err)
+	}
+
+	if err := migrateOrderTotals(); err != nil {
+		log.Printf("Failed to migrate order totals: %v", err)
+	}
+
+	// Completed orders must have their completion time first
+	if markRanked {
+		if err := markRankedOrders(); err != nil {
+			log.Printf("Failed to mark ranked orders: %v", err)
+		}
+	}
+	if err := markLegacyOrdersRanked(); err != nil {
+		log.Printf("Failed to mark legacy orders as ranked: %v", err)
+	}
+
+	if markExpiredLinks {
+		if err := markExpiredLinksNotified(); err != nil {
+			log.Printf("Failed to mark expired links: %v", err)
+		}
+	}
 }
@@ -0,0 +1,150 @@
+package database
+
+import (
+	"ambassador/src/linkcode"
+	"ambassador/src/models"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+)
+
+// maxCodeAttempts bounds how many times a colliding link code is regenerated.
+const maxCodeAttempts = 5
+
+// CreateLinkWithUniqueCode saves the link, generating a fresh code and retrying
+// whenever the unique index on links.code reports a collision.
+func CreateLinkWithUniqueCode(db *gorm.DB, link *models.Link) error {
+	generator := linkcode.Default
+
+	for attempt := 1; attempt <= maxCodeAttempts; attempt++ {
+		code, err := generator.Generate()
+		if err != nil {
+			return err
+		}
+		link.Code = code
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Create(link).Error; err != nil {
+				return err
+			}
+
+			// Sequential codes are derived from the ID, which is only known after insert
+			if generator.Sequential() {
+				encoded, err := generator.Encode(uint64(link.Id))
+				if err != nil {
+					return err
+				}
+				if err := tx.Model(link).Update("code", encoded).Error; err != nil {
+					return err
+				}
+				link.Code = encoded
+			}
+
+			return nil
+		})
+
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return err
+		}
+
+		link.Id = 0
+		log.Printf("Link code collision on attempt %d, regenerating", attempt)
+	}
+
+	return fmt.Errorf("failed to generate a unique link code after %d attempts", maxCodeAttempts)
+}
+
+// reassignDuplicateLinkCodes gives every link that shares its code with an
+// older link a fresh code, so the unique index on links.code can be created.
+// Orders placed by the same ambassador under the old code follow the link.
+func reassignDuplicateLinkCodes() error {
+	if !DB.Migrator().HasTable(&models.Link{}) {
+		return nil
+	}
+
+	var duplicates []string
+	// Soft-deleted links still hold their code in the unique index
+	if err := DB.Unscoped().Model(&models.Link{}).
+		Select("code").
+		Group("code").
+		Having("COUNT(*) > 1").
+		Pluck("code", &duplicates).Error; err != nil {
+		return err
+	}
+
+	for _, code := range duplicates {
+		var links []models.Link
+		if err := DB.Unscoped().Select("id", "code", "user_id").Where("code = ?", code).Order("id").Find(&links).Error; err != nil {
+			return err
+		}
+
+		// Keep the oldest link on its original code
+		for _, link := range links[1:] {
+			newCode, err := uniqueCode()
+			if err != nil {
+				return err
+			}
+
+			err = DB.Transaction(func(tx *gorm.DB) error {
+				if err := tx.Unscoped().Model(&models.Link{}).Where("id = ?", link.Id).Update("code", newCode).Error; err != nil {
+					return err
+				}
+
+				// Only move orders when the original owner is unambiguous
+				if link.UserId != links[0].UserId {
+					return tx.Model(&models.Order{}).
+						Where("code = ? AND user_id = ?", code, link.UserId).
+						Update("code", newCode).Error
+				}
+
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+
+			log.Printf("Reassigned duplicate link code %s on link %d to %s", code, link.Id, newCode)
+		}
+	}
+
+	return nil
+}
+
+// uniqueCode generates a code that is not currently used by any link.
+func uniqueCode() (string, error) {
+	for attempt := 0; attempt < maxCodeAttempts; attempt++ {
+		code, err := linkcode.Default.Generate()
+		if err != nil {
+			return "", err
+		}
+
+		var count int64
+		if err := DB.Unscoped().Model(&models.Link{}).Where("code = ?", code).Count(&count).Error; err != nil {
+			return "", err
+		}
+		if count == 0 {
+			return code, nil
+		}
+	}
+
+	return "", fmt.Errorf("failed to generate a unique link code after %d attempts", maxCodeAttempts)
+}
+
+// markExpiredLinksNotified records links that already expired as reported, so
+// their owners are not notified of old expiries all at once.
+func markExpiredLinksNotified() error {
+	result := DB.Unscoped().Model(&models.Link{}).
+		Where("expires_at <= NOW() AND expiry_notified_at IS NULL").
+		Update("expiry_notified_at", gorm.Expr("expires_at"))
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Marked %d expired links as reported", result.RowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,67 @@
+package database
+
+import (
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"github.com/redis/go-redis/v9"
+	"time"
+)
+
+// lockRetryInterval is how often WaitLock retries a lock held by someone else.
+const lockRetryInterval = 50 * time.Millisecond
+
+var ErrLockTimeout = errors.New("timed out waiting for lock")
+
+// releaseScript deletes a lock only while it still holds the caller's token,
+// so a holder whose lock expired cannot release the next holder's lock.
+var releaseScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0`)
+
+// Lock is a lock held in Redis, shared by every API instance.
+type Lock struct {
+	key   string
+	token string
+}
+
+// AcquireLock takes the lock at key for at most ttl. It returns nil without
+// an error when someone else holds the lock.
+func AcquireLock(ctx context.Context, key string, ttl time.Duration) (*Lock, error) {
+	lock := &Lock{key: key, token: uuid.NewString()}
+
+	acquired, err := Cache.SetNX(ctx, key, lock.token, ttl).Result()
+	if err != nil || !acquired {
+		return nil, err
+	}
+	return lock, nil
+}
+
+// WaitLock takes the lock at key for at most ttl, waiting up to wait for the
+// current holder to release it.
+func WaitLock(ctx context.Context, key string, ttl time.Duration, wait time.Duration) (*Lock, error) {
+	deadline := time.Now().Add(wait)
+
+	for {
+		lock, err := AcquireLock(ctx, key, ttl)
+		if err != nil || lock != nil {
+			return lock, err
+		}
+		if time.Now().After(deadline) {
+			return nil, ErrLockTimeout
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(lockRetryInterval):
+		}
+	}
+}
+
+// Release frees the lock unless it already expired.
+func (lock *Lock) Release() error {
+	return releaseScript.Run(context.Background(), Cache, []string{lock.key}, lock.token).Err()
+}
@@ -0,0 +1,122 @@
+package database
+
+import (
+	"ambassador/src/currency"
+	"ambassador/src/models"
+	"log"
+)
+
+// migrateOrderCreatedAt gives orders placed before creation times were
+// recorded the legacy order time, instead of none at all.
+func migrateOrderCreatedAt() error {
+	result := DB.Exec("UPDATE orders SET created_at = ? WHERE created_at IS NULL OR created_at < ?",
+		models.LegacyOrderTime, models.LegacyOrderTime)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Set the creation time of %d legacy orders", result.RowsAffected)
+	}
+	return nil
+}
+
+// migrateOrderStatus converts the legacy complete flag into the order status
+// and drops the old column once every completed order has been marked paid.
+func migrateOrderStatus() error {
+	if !DB.Migrator().HasColumn(&models.Order{}, "complete") {
+		return nil
+	}
+
+	result := DB.Exec("UPDATE orders SET status = ?, completed_at = COALESCE(completed_at, created_at) WHERE complete = ? AND status = ?",
+		models.OrderPaid, true, models.OrderPending)
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Marked %d completed orders as paid", result.RowsAffected)
+
+	return DB.Migrator().DropColumn(&models.Order{}, "complete")
+}
+
+// migrateOrderCompletedAt gives orders that were paid before completion times
+// were recorded their creation time, which for them is the legacy order time.
+func migrateOrderCompletedAt() error {
+	result := DB.Exec("UPDATE orders SET completed_at = created_at WHERE completed_at IS NULL AND status IN ?",
+		[]string{models.OrderPaid, models.OrderPartiallyRefunded, models.OrderRefunded})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Set the completion time of %d legacy orders", result.RowsAffected)
+	}
+	return nil
+}
+
+// migrateOrderCurrency assigns the base currency to orders placed before
+// checkout supported other currencies, with the current reporting rate.
+func migrateOrderCurrency() error {
+	reportingRate, err := currency.Rate(DB, currency.Reporting())
+	if err != nil {
+		return err
+	}
+
+	result := DB.Exec("UPDATE orders SET currency = ?, reporting_rate = ? WHERE currency = '' OR currency IS NULL",
+		currency.Base(), reportingRate)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Assigned the base currency to %d orders", result.RowsAffected)
+	}
+
+	return DB.Exec("UPDATE order_items oi JOIN orders o ON o.id = oi.order_id SET oi.currency = o.currency WHERE oi.currency = '' OR oi.currency IS NULL").Error
+}
+
+// migrateOrderTotals stores the item total of orders created before it was
+// kept on the order, so listings can filter and sort on it.
+func migrateOrderTotals() error {
+	result := DB.Exec(`UPDATE orders o
+		JOIN (SELECT order_id, SUM(price * quantity - discount) AS total FROM order_items GROUP BY order_id) t ON t.order_id = o.id
+		SET o.total = t.total
+		WHERE o.total = 0 AND t.total <> 0`)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Stored the total of %d orders", result.RowsAffected)
+	}
+	return nil
+}
+
+// markRankedOrders records the orders and refunds that were added to the
+// leaderboards before they were tracked, so a rebuild keeps counting them.
+// Orders whose rankings event is still in the outbox are left to it.
+func markRankedOrders() error {
+	result := DB.Exec(`UPDATE orders SET ranked_at = completed_at
+		WHERE completed_at IS NOT NULL AND ranked_at IS NULL
+		AND id NOT IN (
+			SELECT CAST(JSON_UNQUOTE(JSON_EXTRACT(payload, '$.order_id')) AS UNSIGNED)
+			FROM outbox_events WHERE type = 'order.completed.rankings' AND status <> ?
+		)`, models.OutboxDelivered)
+	if result.Error != nil {
+		return result.Error
+	}
+	log.Printf("Marked %d orders as ranked", result.RowsAffected)
+
+	// Refunds were taken off the leaderboards as soon as they were recorded
+	return DB.Exec("UPDATE refunds SET ranked_at = created_at WHERE ranked_at IS NULL").Error
+}
+
+// markLegacyOrdersRanked records the orders paid before completion times were
+// recorded as ranked. They were added to the leaderboards when they were paid,
+// long before the outbox, but had no completion time when markRankedOrders ran
+// on databases migrated before legacy orders were given one.
+func markLegacyOrdersRanked() error {
+	result := DB.Exec("UPDATE orders SET ranked_at = completed_at WHERE ranked_at IS NULL AND completed_at = ?", models.LegacyOrderTime)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Marked %d legacy orders as ranked", result.RowsAffected)
+	}
+	return nil
+}
@@ -0,0 +1,126 @@
+package exports
+
+import (
+	"ambassador/src/currency"
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"ambassador/src/orders"
+	"context"
+	"encoding/json"
+	"errors"
+	"gorm.io/gorm"
+)
+
+// Export types.
+const (
+	TypeOrders      = "orders"
+	TypeAmbassadors = "ambassadors"
+)
+
+const batchSize = 500
+
+var ErrInvalidType = errors.New("type must be orders or ambassadors")
+
+// Dataset writes the rows of an export, starting with a header row.
+type Dataset func(ctx context.Context, w Writer) error
+
+// DatasetFor returns the dataset of an export type. Order exports are
+// narrowed down by the JSON-encoded orders.Filter.
+func DatasetFor(exportType string, filter string) (Dataset, error) {
+	switch exportType {
+	case TypeOrders:
+		var f orders.Filter
+		if filter != "" {
+			if err := json.Unmarshal([]byte(filter), &f); err != nil {
+				return nil, err
+			}
+		}
+		return Orders(f), nil
+	case TypeAmbassadors:
+		return Ambassadors(), nil
+	}
+	return nil, ErrInvalidType
+}
+
+// Orders exports the orders matching the filter with their computed totals,
+// loading them in batches.
+func Orders(filter orders.Filter) Dataset {
+	return func(ctx context.Context, w Writer) error {
+		err := w.WriteRow([]interface{}{
+			"id", "created_at", "completed_at", "status", "link_code", "ambassador_id", "ambassador_email",
+			"customer_name", "customer_email", "country", "currency", "total", "discount", "tax", "shipping",
+			"charged_total", "refunded_amount", "commission", "admin_revenue", "commission_" + currency.Reporting(),
+		})
+		if err != nil {
+			return err
+		}
+
+		var batch []models.Order
+		result := filter.Apply(database.DB.WithContext(ctx).Model(&models.Order{})).
+			Preload("OrderItems").
+			FindInBatches(&batch, batchSize, func(tx *gorm.DB, _ int) error {
+				for _, order := range batch {
+					commission, adminRevenue := 0.0, 0.0
+					for _, item := range order.OrderItems {
+						commission += item.AmbassadorRevenue
+						adminRevenue += item.AdminRevenue
+					}
+
+					err := w.WriteRow([]interface{}{
+						order.Id, order.CreatedAt, order.CompletedAt, order.Status, order.Code, order.UserId, order.AmbassadorEmail,
+						order.FullName(), order.Email, order.Country, order.Currency, order.GetTotal(), order.Discount, order.Tax, order.Shipping,
+						order.GetChargedTotal(), order.RefundedAmount, commission, adminRevenue, currency.Round(order.ReportingAmount(commission)),
+					})
+					if err != nil {
+						return err
+					}
+				}
+				return nil
+			})
+		return result.Error
+	}
+}
+
+// Ambassadors exports every ambassador with their completed orders and
+// commission in the reporting currency, streaming rows from the database.
+func Ambassadors() Dataset {
+	return func(ctx context.Context, w Writer) error {
+		err := w.WriteRow([]interface{}{
+			"id", "first_name", "last_name", "name", "email", "orders", "revenue_" + currency.Reporting(),
+		})
+		if err != nil {
+			return err
+		}
+
+		rows, err := database.DB.WithContext(ctx).Table("users AS u").
+			Select("u.id, u.first_name, u.last_name, u.email, COUNT(DISTINCT o.id), COALESCE(SUM(oi.ambassador_revenue * o.reporting_rate), 0)").
+			Joins("LEFT JOIN orders o ON o.user_id = u.id AND o.status IN ?", models.RevenueStatuses).
+			Joins("LEFT JOIN order_items oi ON oi.order_id = o.id").
+			Where("u.is_ambassador = ?", true).
+			Group("u.id, u.first_name, u.last_name, u.email").
+			Order("u.id").
+			Rows()
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var user models.User
+			var orderCount int64
+			var revenue float64
+			if err := rows.Scan(&user.Id, &user.FirstName, &user.LastName, &user.Email, &orderCount, &revenue); err != nil {
+				return err
+			}
+
+			err := w.WriteRow([]interface{}{
+				user.Id, user.FirstName, user.LastName, user.Name(), user.Email, orderCount, currency.Round(revenue),
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		return rows.Err()
+	}
+}
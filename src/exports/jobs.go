@@ -0,0 +1,178 @@
+package exports
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"ambassador/src/scheduler"
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// heartbeatInterval is how often a running job records that it is alive.
+	heartbeatInterval = 30 * time.Second
+
+	// staleAfter is how long a job may go without a heartbeat before it is
+	// considered interrupted, e.g. by the restart of the instance running it.
+	staleAfter = 3 * heartbeatInterval
+)
+
+// StaleJob periodically fails jobs whose instance stopped running them. The
+// interval is read from EXPORT_CLEANUP_INTERVAL (e.g. "1m").
+var StaleJob = scheduler.Job{
+	Name:        "Export cleanup",
+	IntervalEnv: "EXPORT_CLEANUP_INTERVAL",
+	LockKey:     "exports:cleanup:lock",
+	Run:         failStale,
+}
+
+// Dir returns the directory export files are written to, configured with
+// EXPORT_DIR and defaulting to a folder in the system temp directory. When
+// several API instances run, it must be a volume they all share: any of
+// them may serve the download of a file another one wrote.
+func Dir() string {
+	if dir := os.Getenv("EXPORT_DIR"); dir != "" {
+		return dir
+	}
+	return filepath.Join(os.TempDir(), "ambassador-exports")
+}
+
+// FileName returns the download name of an export.
+func FileName(export models.Export) string {
+	return fmt.Sprintf("%s-%d-%s.%s", export.Type, export.Id, export.CreatedAt.Format("20060102"), export.Format)
+}
+
+// Setup fails jobs that were interrupted by a restart.
+func Setup() {
+	if err := failStale(context.Background()); err != nil {
+		log.Printf("Failed to fail interrupted exports: %v", err)
+	}
+}
+
+// failStale fails the jobs no instance is running anymore: pending jobs that
+// never started and running jobs without a recent heartbeat. Jobs other
+// instances are running keep their heartbeat fresh and are left alone.
+func failStale(ctx context.Context) error {
+	cutoff := time.Now().Add(-staleAfter)
+
+	result := database.DB.WithContext(ctx).Model(&models.Export{}).
+		Where("(status = ? AND created_at < ?) OR (status = ? AND (heartbeat_at IS NULL OR heartbeat_at < ?))",
+			models.ExportPending, cutoff, models.ExportRunning, cutoff).
+		Updates(map[string]interface{}{"status": models.ExportFailed, "error": "interrupted by a server restart"})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected > 0 {
+		log.Printf("Failed %d interrupted exports", result.RowsAffected)
+	}
+	return nil
+}
+
+// Start runs the export in the background, writing its file to Dir.
+func Start(export models.Export) {
+	go func() {
+		if err := run(export); err != nil {
+			log.Printf("Export %d failed: %v", export.Id, err)
+			database.DB.Model(&models.Export{}).Where("id = ?", export.Id).
+				Updates(map[string]interface{}{"status": models.ExportFailed, "error": err.Error()})
+		}
+	}()
+}
+
+func run(export models.Export) error {
+	dataset, err := DatasetFor(export.Type, export.Filter)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	err = database.DB.Model(&export).Updates(map[string]interface{}{"status": models.ExportRunning, "heartbeat_at": &now}).Error
+	if err != nil {
+		return err
+	}
+
+	// Keep other instances from failing the job while it runs
+	stop := make(chan struct{})
+	defer close(stop)
+	go heartbeat(export.Id, stop)
+
+	if err := os.MkdirAll(Dir(), 0o750); err != nil {
+		return err
+	}
+	path := filepath.Join(Dir(), FileName(export))
+
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	writer, err := NewWriter(export.Format, file)
+	if err != nil {
+		return err
+	}
+	counter := &countingWriter{Writer: writer}
+
+	if err := dataset(context.Background(), counter); err != nil {
+		os.Remove(path)
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		os.Remove(path)
+		return err
+	}
+
+	now = time.Now()
+	result := database.DB.Model(&models.Export{}).
+		Where("id = ? AND status = ?", export.Id, models.ExportRunning).
+		Updates(map[string]interface{}{
+			"status":       models.ExportCompleted,
+			"path":         path,
+			"rows":         counter.rows - 1, // without the header
+			"completed_at": &now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		// The job was failed as stale meanwhile, so its file is not offered
+		log.Printf("Export %d was failed while it ran, discarding its file", export.Id)
+		os.Remove(path)
+	}
+	return nil
+}
+
+// heartbeat records that the job is running until stop is closed.
+func heartbeat(id uint, stop chan struct{}) {
+	ticker := time.NewTicker(heartbeatInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			err := database.DB.Model(&models.Export{}).
+				Where("id = ? AND status = ?", id, models.ExportRunning).
+				Update("heartbeat_at", time.Now()).Error
+			if err != nil {
+				log.Printf("Failed to record heartbeat of export %d: %v", id, err)
+			}
+		}
+	}
+}
+
+// countingWriter counts the rows written through it.
+type countingWriter struct {
+	Writer
+	rows int64
+}
+
+func (cw *countingWriter) WriteRow(values []interface{}) error {
+	cw.rows++
+	return cw.Writer.WriteRow(values)
+}
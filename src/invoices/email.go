@@ -0,0 +1,42 @@
+package invoices
+
+import (
+	"ambassador/src/mailer"
+	"ambassador/src/models"
+	"time"
+)
+
+// Send issues the invoice of a paid order and emails it to the customer as
+// an attachment, together with a signed link to download it again later.
+func Send(order models.Order) error {
+	if order.Email == "" {
+		return nil
+	}
+
+	invoice, err := Issue(&order)
+	if err != nil {
+		return err
+	}
+
+	document, err := Render(order, invoice)
+	if err != nil {
+		return err
+	}
+
+	expires := time.Now().Add(LinkTTL)
+	return mailer.NotifyNow("invoice", mailer.LocaleFor(order.Country), []string{order.Email}, map[string]interface{}{
+		"Order":   &order,
+		"Invoice": &invoice,
+		"URL":     SignedURL(order.Id, expires),
+		"Expires": expires,
+	}, mailer.Attachment{
+		Filename:    FileName(invoice),
+		ContentType: "application/pdf",
+		Data:        document,
+	})
+}
+
+// FileName is the name invoices are downloaded and attached as.
+func FileName(invoice models.Invoice) string {
+	return invoice.Reference() + ".pdf"
+}
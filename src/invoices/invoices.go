@@ -0,0 +1,213 @@
+package invoices
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"os"
+	"strings"
+	"time"
+)
+
+const maxNumberAttempts = 5
+
+var ErrNotInvoiceable = errors.New("only paid orders can be invoiced")
+
+// invoiceable are the statuses of orders that were paid at some point.
+var invoiceable = []string{models.OrderPaid, models.OrderPartiallyRefunded, models.OrderRefunded}
+
+// Issue returns the invoice of a paid order, assigning the next invoice
+// number the first time. Numbers are unique, so concurrent issuers retry
+// with the following number.
+func Issue(order *models.Order) (models.Invoice, error) {
+	var invoice models.Invoice
+
+	if !invoiceableStatus(order.Status) {
+		return invoice, ErrNotInvoiceable
+	}
+
+	for attempt := 0; attempt < maxNumberAttempts; attempt++ {
+		err := database.DB.Where("order_id = ?", order.Id).First(&invoice).Error
+		if err == nil {
+			return invoice, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return invoice, err
+		}
+
+		var last uint
+		if err := database.DB.Model(&models.Invoice{}).Select("COALESCE(MAX(number), 0)").Scan(&last).Error; err != nil {
+			return invoice, err
+		}
+
+		invoice = models.Invoice{OrderId: order.Id, Number: last + 1, IssuedAt: time.Now()}
+		err = database.DB.Create(&invoice).Error
+		if err == nil {
+			return invoice, nil
+		}
+		if !errors.Is(err, gorm.ErrDuplicatedKey) {
+			return invoice, err
+		}
+	}
+
+	return invoice, fmt.Errorf("could not assign an invoice number to order %d", order.Id)
+}
+
+func invoiceableStatus(status string) bool {
+	for _, s := range invoiceable {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+// Layout of the item table, in points from the left edge.
+const (
+	marginLeft   = 50.0
+	marginRight  = 545.0
+	marginBottom = 90.0
+	colItem      = 50.0
+	colQuantity  = 280.0
+	colUnit      = 350.0
+	colDiscount  = 415.0
+	colTax       = 475.0
+	colAmount    = 545.0
+	rowHeight    = 16.0
+)
+
+// Render draws the invoice of an order loaded with its order items.
+func Render(order models.Order, invoice models.Invoice) ([]byte, error) {
+	d := newDocument()
+	y := pageHeight - 60
+
+	// Header with the issuer on the left and the invoice details on the right
+	d.text(fontBold, 22, marginLeft, y, "INVOICE")
+	d.textRight(fontBold, 11, marginRight, y, invoice.Reference())
+	d.textRight(fontRegular, 10, marginRight, y-15, "Date: "+invoice.IssuedAt.Format("2006-01-02"))
+	d.textRight(fontRegular, 10, marginRight, y-29, fmt.Sprintf("Order #%d", order.Id))
+	d.textRight(fontRegular, 10, marginRight, y-43, "Amounts in "+order.Currency)
+
+	y -= 30
+	for _, line := range issuer() {
+		d.text(fontRegular, 10, marginLeft, y, line)
+		y -= 13
+	}
+
+	// Customer address
+	y -= 20
+	d.text(fontBold, 11, marginLeft, y, "Bill to")
+	y -= 15
+	for _, line := range billTo(order) {
+		d.text(fontRegular, 10, marginLeft, y, fit(fontRegular, 10, line, 300))
+		y -= 13
+	}
+
+	// Item table, continued on new pages as needed
+	y -= 25
+	y = tableHeader(d, y)
+	for _, item := range order.OrderItems {
+		if y < marginBottom {
+			d.addPage()
+			y = tableHeader(d, pageHeight-60)
+		}
+
+		d.text(fontRegular, 10, colItem, y, fit(fontRegular, 10, item.ProductTitle, colQuantity-colItem-40))
+		d.textRight(fontRegular, 10, colQuantity, y, fmt.Sprintf("%d", item.Quantity))
+		d.textRight(fontRegular, 10, colUnit, y, money(item.Price))
+		d.textRight(fontRegular, 10, colDiscount, y, money(-item.Discount))
+		d.textRight(fontRegular, 10, colTax, y, money(item.Tax))
+		d.textRight(fontRegular, 10, colAmount, y, money(item.GetTotal()))
+		y -= rowHeight
+	}
+
+	// Totals
+	if y < marginBottom+100 {
+		d.addPage()
+		y = pageHeight - 60
+	}
+	d.line(marginLeft, marginRight, y+rowHeight-4)
+	y -= 6
+
+	totals := [][2]string{{"Subtotal", money(order.GetTotal())}}
+	if order.CouponCode != "" {
+		totals = append(totals, [2]string{"Coupon " + order.CouponCode, money(-order.Discount)})
+	}
+	if order.TaxInclusive {
+		totals = append(totals, [2]string{"Tax included", money(order.Tax)})
+	} else {
+		totals = append(totals, [2]string{"Tax", money(order.Tax)})
+	}
+	totals = append(totals, [2]string{"Shipping", money(order.Shipping)})
+
+	for _, total := range totals {
+		d.text(fontRegular, 10, colDiscount-60, y, total[0])
+		d.textRight(fontRegular, 10, colAmount, y, total[1])
+		y -= rowHeight
+	}
+
+	d.text(fontBold, 11, colDiscount-60, y, "Total")
+	d.textRight(fontBold, 11, colAmount, y, money(order.GetChargedTotal())+" "+order.Currency)
+	y -= rowHeight
+
+	if order.RefundedAmount > 0 {
+		d.text(fontRegular, 10, colDiscount-60, y, "Refunded")
+		d.textRight(fontRegular, 10, colAmount, y, money(-order.RefundedAmount))
+	}
+
+	d.text(fontRegular, 9, marginLeft, 50, "Thank you for your order.")
+
+	return d.bytes()
+}
+
+func tableHeader(d *document, y float64) float64 {
+	d.text(fontBold, 10, colItem, y, "Item")
+	d.textRight(fontBold, 10, colQuantity, y, "Qty")
+	d.textRight(fontBold, 10, colUnit, y, "Unit price")
+	d.textRight(fontBold, 10, colDiscount, y, "Discount")
+	d.textRight(fontBold, 10, colTax, y, "Tax")
+	d.textRight(fontBold, 10, colAmount, y, "Amount")
+	d.line(marginLeft, marginRight, y-5)
+	return y - rowHeight - 4
+}
+
+// issuer returns the lines of the seller block, configured with
+// INVOICE_ISSUER as semicolon-separated lines.
+func issuer() []string {
+	value := os.Getenv("INVOICE_ISSUER")
+	if value == "" {
+		return []string{"Ambassador"}
+	}
+
+	var lines []string
+	for _, line := range strings.Split(value, ";") {
+		if line = strings.TrimSpace(line); line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func billTo(order models.Order) []string {
+	lines := []string{order.FullName()}
+	for _, line := range []string{
+		order.Address,
+		strings.TrimSpace(order.Zip + " " + order.City),
+		strings.TrimSpace(strings.Trim(order.Region+", "+order.Country, ", ")),
+		order.Email,
+	} {
+		if line != "" {
+			lines = append(lines, line)
+		}
+	}
+	return lines
+}
+
+func money(amount float64) string {
+	if amount == 0 {
+		amount = 0 // avoid printing -0.00
+	}
+	return fmt.Sprintf("%.2f", amount)
+}
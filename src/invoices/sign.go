@@ -0,0 +1,74 @@
+package invoices
+
+import (
+	"ambassador/src/middlewares"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LinkTTL is how long a customer's invoice download link stays valid.
+const LinkTTL = 30 * 24 * time.Hour
+
+var (
+	ErrInvalidSignature = errors.New("invalid invoice signature")
+	ErrLinkExpired      = errors.New("invoice link has expired")
+)
+
+// SignedURL returns a link the customer can use to download the invoice of
+// an order without logging in, valid until the given time.
+func SignedURL(orderId uint, expires time.Time) string {
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", sign(orderId, expires.Unix()))
+
+	return fmt.Sprintf("%s/api/checkout/orders/%d/invoice?%s", apiURL(), orderId, query.Encode())
+}
+
+// Verify checks the expires and signature query parameters of a signed link.
+func Verify(orderId uint, expires, signature string) error {
+	timestamp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return ErrInvalidSignature
+	}
+
+	expected := sign(orderId, timestamp)
+	if !hmac.Equal([]byte(expected), []byte(signature)) {
+		return ErrInvalidSignature
+	}
+
+	if time.Now().Unix() > timestamp {
+		return ErrLinkExpired
+	}
+
+	return nil
+}
+
+func sign(orderId uint, expires int64) string {
+	mac := hmac.New(sha256.New, signingKey())
+	fmt.Fprintf(mac, "%d:%d", orderId, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// signingKey is INVOICE_SIGNING_KEY, falling back to the JWT secret.
+func signingKey() []byte {
+	if key := os.Getenv("INVOICE_SIGNING_KEY"); key != "" {
+		return []byte(key)
+	}
+	return []byte(middlewares.SecretKey)
+}
+
+// apiURL is the public address of this API, configured with API_URL.
+func apiURL() string {
+	if value := os.Getenv("API_URL"); value != "" {
+		return strings.TrimRight(value, "/")
+	}
+	return "http://localhost:8000"
+}
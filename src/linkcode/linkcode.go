@@ -0,0 +1,150 @@
+package linkcode
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"errors"
+	"math/big"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// Base62 is the default alphabet used for link codes.
+	Base62 = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz"
+
+	// StrategyRandom draws every character uniformly from the alphabet.
+	StrategyRandom = "random"
+	// StrategyHashid derives the code from the link ID using a salted alphabet.
+	StrategyHashid = "hashid"
+
+	defaultLength = 8
+	minLength     = 4
+	maxLength     = 64
+)
+
+// Generator produces link codes from a configurable alphabet and length.
+type Generator struct {
+	Alphabet string
+	Length   int
+	Strategy string
+	Salt     string
+}
+
+// Default is the generator used by the application, configured from the environment.
+var Default = FromEnv()
+
+// New returns a generator, falling back to sane defaults for invalid settings.
+func New(alphabet string, length int, strategy string, salt string) *Generator {
+	if len(uniqueChars(alphabet)) < 16 {
+		alphabet = Base62
+	}
+	if length < minLength || length > maxLength {
+		length = defaultLength
+	}
+	if strategy != StrategyHashid {
+		strategy = StrategyRandom
+	}
+
+	return &Generator{
+		Alphabet: uniqueChars(alphabet),
+		Length:   length,
+		Strategy: strategy,
+		Salt:     salt,
+	}
+}
+
+// FromEnv builds a generator from LINK_CODE_ALPHABET, LINK_CODE_LENGTH,
+// LINK_CODE_STRATEGY and LINK_CODE_SALT.
+func FromEnv() *Generator {
+	length, _ := strconv.Atoi(os.Getenv("LINK_CODE_LENGTH"))
+
+	return New(
+		os.Getenv("LINK_CODE_ALPHABET"),
+		length,
+		os.Getenv("LINK_CODE_STRATEGY"),
+		os.Getenv("LINK_CODE_SALT"),
+	)
+}
+
+// Sequential reports whether codes are derived from the link ID after insert.
+func (g *Generator) Sequential() bool {
+	return g.Strategy == StrategyHashid
+}
+
+// Generate returns a random code of the configured length.
+func (g *Generator) Generate() (string, error) {
+	max := big.NewInt(int64(len(g.Alphabet)))
+	code := make([]byte, g.Length)
+
+	for i := range code {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		code[i] = g.Alphabet[n.Int64()]
+	}
+
+	return string(code), nil
+}
+
+// Encode derives a hashids-style code from an ID. Distinct IDs always yield
+// distinct codes; short results are left-padded with the salted alphabet.
+func (g *Generator) Encode(id uint64) (string, error) {
+	if id == 0 {
+		return "", errors.New("linkcode: cannot encode zero id")
+	}
+
+	alphabet := shuffle(g.Alphabet, g.Salt)
+
+	// Reserve the first character as padding so padding never collides with digits
+	pad, digits := alphabet[0], alphabet[1:]
+	base := uint64(len(digits))
+
+	var encoded []byte
+	for n := id; n > 0; n /= base {
+		encoded = append([]byte{digits[n%base]}, encoded...)
+	}
+
+	if len(encoded) < g.Length {
+		encoded = append([]byte(strings.Repeat(string(pad), g.Length-len(encoded))), encoded...)
+	}
+
+	return string(encoded), nil
+}
+
+// shuffle deterministically permutes the alphabet using the salt.
+func shuffle(alphabet string, salt string) string {
+	if salt == "" {
+		return alphabet
+	}
+
+	chars := []byte(alphabet)
+	seed := sha256.Sum256([]byte(salt))
+
+	for i := len(chars) - 1; i > 0; i-- {
+		j := int(seed[i%len(seed)]) % (i + 1)
+		chars[i], chars[j] = chars[j], chars[i]
+		if i%len(seed) == 0 {
+			seed = sha256.Sum256(seed[:])
+		}
+	}
+
+	return string(chars)
+}
+
+// uniqueChars removes duplicate characters while keeping their order.
+func uniqueChars(s string) string {
+	seen := make(map[byte]bool)
+	var b strings.Builder
+
+	for i := 0; i < len(s); i++ {
+		if !seen[s[i]] {
+			seen[s[i]] = true
+			b.WriteByte(s[i])
+		}
+	}
+
+	return b.String()
+}
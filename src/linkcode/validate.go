@@ -0,0 +1,93 @@
+package linkcode
+
+import (
+	"errors"
+	"os"
+	"strings"
+)
+
+const (
+	// MinVanityLength and MaxVanityLength bound codes chosen by ambassadors.
+	MinVanityLength = 3
+	MaxVanityLength = 32
+)
+
+var (
+	ErrInvalidLength     = errors.New("code must be between 3 and 32 characters")
+	ErrInvalidCharacters = errors.New("code may only contain letters, numbers, '-' and '_'")
+	ErrInvalidEdges      = errors.New("code must start and end with a letter or number")
+	ErrReserved          = errors.New("code is reserved")
+	ErrBlocked           = errors.New("code contains a blocked word")
+)
+
+// Reserved lists codes that clash with routes or would confuse customers.
+var Reserved = map[string]bool{
+	"admin": true, "administrator": true, "ambassador": true, "api": true,
+	"available": true, "checkout": true, "confirm": true, "edit": true,
+	"error": true, "help": true, "links": true, "login": true,
+	"logout": true, "new": true, "null": true, "orders": true,
+	"products": true, "rankings": true, "register": true, "root": true,
+	"stats": true, "success": true, "support": true, "undefined": true,
+	"user": true, "users": true,
+}
+
+// Blocklist holds words that may not appear anywhere in a vanity code.
+// Extra entries can be supplied as a comma-separated LINK_CODE_BLOCKLIST.
+var Blocklist = append([]string{
+	"asshole", "bitch", "bastard", "cunt", "fuck", "nigger", "nigga",
+	"porn", "pussy", "retard", "shit", "slut", "whore",
+}, splitList(os.Getenv("LINK_CODE_BLOCKLIST"))...)
+
+// leetReplacer maps common look-alike characters back to letters so the
+// blocklist cannot be bypassed with simple substitutions.
+var leetReplacer = strings.NewReplacer(
+	"0", "o", "1", "i", "3", "e", "4", "a", "5", "s", "7", "t", "8", "b", "@", "a", "$", "s",
+	"-", "", "_", "",
+)
+
+// Validate checks a vanity code chosen by an ambassador. It does not check
+// whether the code is already taken.
+func Validate(code string) error {
+	if len(code) < MinVanityLength || len(code) > MaxVanityLength {
+		return ErrInvalidLength
+	}
+
+	for _, r := range code {
+		if !isAlphanumeric(r) && r != '-' && r != '_' {
+			return ErrInvalidCharacters
+		}
+	}
+
+	if !isAlphanumeric(rune(code[0])) || !isAlphanumeric(rune(code[len(code)-1])) {
+		return ErrInvalidEdges
+	}
+
+	lower := strings.ToLower(code)
+	if Reserved[lower] {
+		return ErrReserved
+	}
+
+	normalized := leetReplacer.Replace(lower)
+	for _, word := range Blocklist {
+		if strings.Contains(lower, word) || strings.Contains(normalized, word) {
+			return ErrBlocked
+		}
+	}
+
+	return nil
+}
+
+func isAlphanumeric(r rune) bool {
+	return (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9')
+}
+
+// splitList parses a comma-separated list into lowercase, trimmed entries.
+func splitList(s string) []string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.ToLower(strings.TrimSpace(item)); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
@@ -0,0 +1,114 @@
+package links
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/mailer"
+	"ambassador/src/models"
+	"ambassador/src/notifications"
+	"ambassador/src/webhooks"
+	"context"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+const batchSize = 100
+
+// Report summarises one expiry run.
+type Report struct {
+	Expired int `json:"expired"`
+	Emailed int `json:"emailed"`
+	Errors  int `json:"errors"`
+}
+
+// NotifyExpired tells the owners of links that passed their expiry date
+// since the last run, through the channels they chose. Each link is only
+// reported once until its expiry date is changed.
+func NotifyExpired(ctx context.Context) (Report, error) {
+	var report Report
+	now := time.Now()
+	lastId := uint(0)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		// Walk the candidates in batches so memory stays bounded
+		var expired []models.Link
+		err := database.DB.Preload("User").
+			Where("expires_at <= ? AND expiry_notified_at IS NULL AND id > ?", now, lastId).
+			Order("id").
+			Limit(batchSize).
+			Find(&expired).Error
+		if err != nil {
+			return report, err
+		}
+		if len(expired) == 0 {
+			if report.Expired > 0 {
+				webhooks.Wake()
+			}
+			return report, nil
+		}
+
+		for _, link := range expired {
+			lastId = link.Id
+
+			claimed, err := notify(link, now)
+			if err != nil {
+				log.Printf("Failed to notify expiry of link %d: %v", link.Id, err)
+				report.Errors++
+				continue
+			}
+			if !claimed {
+				// Another run or an update of the expiry date got there first
+				continue
+			}
+			report.Expired++
+
+			if sent, err := sendEmail(link); err != nil {
+				log.Printf("Failed to send expiry email for link %d: %v", link.Id, err)
+			} else if sent {
+				report.Emailed++
+			}
+		}
+	}
+}
+
+// notify marks the link as reported and records its notification and
+// webhook deliveries together. It returns false when the link was already
+// reported.
+func notify(link models.Link, now time.Time) (bool, error) {
+	claimed := false
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&models.Link{}).
+			Where("id = ? AND expiry_notified_at IS NULL", link.Id).
+			Update("expiry_notified_at", now)
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+		claimed = true
+
+		if err := notifications.LinkExpired(tx, link); err != nil {
+			return err
+		}
+		return webhooks.Publish(tx, webhooks.EventLinkExpired, link.UserId, webhooks.LinkExpired(link))
+	})
+
+	return claimed && err == nil, err
+}
+
+// sendEmail emails the owner unless they turned expiry emails off.
+func sendEmail(link models.Link) (bool, error) {
+	allowed, err := notifications.Allows(database.DB, link.UserId, notifications.TypeLinkExpired, notifications.ChannelEmail)
+	if err != nil || !allowed || link.User.Email == "" {
+		return false, err
+	}
+
+	err = mailer.Notify("link_expired", mailer.Locale(), []string{link.User.Email}, map[string]interface{}{
+		"Link":      &link,
+		"ExpiredAt": *link.ExpiresAt,
+	})
+	return err == nil, err
+}
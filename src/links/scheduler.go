@@ -0,0 +1,24 @@
+package links
+
+import (
+	"ambassador/src/scheduler"
+	"context"
+	"log"
+)
+
+// ExpiryJob periodically notifies ambassadors of expired links. The interval
+// is read from LINK_EXPIRY_INTERVAL (e.g. "5m").
+var ExpiryJob = scheduler.Job{
+	Name:        "Link expiry",
+	IntervalEnv: "LINK_EXPIRY_INTERVAL",
+	LockKey:     "links:expiry:lock",
+	Run:         notifyExpired,
+}
+
+func notifyExpired(ctx context.Context) error {
+	report, err := NotifyExpired(ctx)
+	if report.Expired > 0 || report.Errors > 0 {
+		log.Printf("Link expiry: %+v", report)
+	}
+	return err
+}
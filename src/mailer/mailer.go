@@ -0,0 +1,179 @@
+package mailer
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	queueSize   = 256
+	maxAttempts = 3
+	retryDelay  = 2 * time.Second
+)
+
+// Message is an email ready to be delivered.
+type Message struct {
+	From        string
+	To          []string
+	Subject     string
+	Text        string
+	HTML        string
+	Attachments []Attachment
+}
+
+// Attachment is a file sent along with a message.
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Transport delivers messages, e.g. over SMTP or to disk.
+type Transport interface {
+	Send(message Message) error
+}
+
+var (
+	transport     Transport
+	transportOnce sync.Once
+
+	queue   chan Message
+	queueMu sync.RWMutex
+	done    sync.WaitGroup
+)
+
+// NewTransport returns the transport configured with MAIL_TRANSPORT: smtp
+// (the default), file or log.
+func NewTransport() (Transport, error) {
+	switch strings.ToLower(os.Getenv("MAIL_TRANSPORT")) {
+	case "", "smtp":
+		return NewSMTPTransport(), nil
+	case "file":
+		return NewFileTransport(os.Getenv("MAIL_DIR")), nil
+	case "log":
+		return LogTransport{}, nil
+	}
+	return nil, fmt.Errorf("unknown mail transport %q", os.Getenv("MAIL_TRANSPORT"))
+}
+
+// Send delivers a message immediately with the configured transport.
+func Send(message Message) error {
+	transportOnce.Do(func() {
+		var err error
+		if transport, err = NewTransport(); err != nil {
+			log.Printf("%v, logging emails instead", err)
+			transport = LogTransport{}
+		}
+	})
+
+	if message.From == "" {
+		message.From = From()
+	}
+	return transport.Send(message)
+}
+
+// Setup starts the background worker that delivers queued messages.
+func Setup() {
+	queueMu.Lock()
+	defer queueMu.Unlock()
+
+	queue = make(chan Message, queueSize)
+
+	done.Add(1)
+	go func(queue chan Message) {
+		defer done.Done()
+		for message := range queue {
+			deliver(message)
+		}
+	}(queue)
+}
+
+// Close stops accepting messages and waits for the queued ones to be delivered.
+func Close() {
+	queueMu.Lock()
+	if queue == nil {
+		queueMu.Unlock()
+		return
+	}
+	close(queue)
+	queue = nil
+	queueMu.Unlock()
+
+	done.Wait()
+	log.Println("Email queue flushed")
+}
+
+// Queue hands a message to the background worker. Without a running worker,
+// e.g. in CLI commands, the message is delivered before Queue returns.
+func Queue(message Message) {
+	queueMu.RLock()
+	defer queueMu.RUnlock()
+
+	if queue == nil {
+		deliver(message)
+		return
+	}
+	queue <- message
+}
+
+// Notify renders a notification and queues it for the recipients.
+func Notify(name, locale string, to []string, data interface{}, attachments ...Attachment) error {
+	message, err := Render(name, locale, data)
+	if err != nil {
+		return err
+	}
+
+	message.To = to
+	message.Attachments = attachments
+	Queue(message)
+	return nil
+}
+
+// NotifyNow renders a notification and sends it right away, for callers
+// that retry failed deliveries themselves.
+func NotifyNow(name, locale string, to []string, data interface{}, attachments ...Attachment) error {
+	message, err := Render(name, locale, data)
+	if err != nil {
+		return err
+	}
+
+	message.To = to
+	message.Attachments = attachments
+	return Send(message)
+}
+
+// deliver sends a message, retrying transient failures with a growing delay.
+func deliver(message Message) {
+	for attempt := 1; ; attempt++ {
+		err := Send(message)
+		if err == nil {
+			return
+		}
+		if attempt == maxAttempts {
+			log.Printf("Failed to send %q to %s: %v", message.Subject, strings.Join(message.To, ", "), err)
+			return
+		}
+		time.Sleep(time.Duration(attempt) * retryDelay)
+	}
+}
+
+// From is the sender address, configured with MAIL_FROM.
+func From() string {
+	if from := os.Getenv("MAIL_FROM"); from != "" {
+		return from
+	}
+	return "no-reply@email.com"
+}
+
+// AdminAddress receives the notifications meant for the shop admin,
+// configured with ADMIN_EMAIL.
+func AdminAddress() string {
+	if address := os.Getenv("ADMIN_EMAIL"); address != "" {
+		return address
+	}
+	return "admin@admin.com"
+}
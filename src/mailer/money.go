@@ -0,0 +1,81 @@
+package mailer
+
+import (
+	"golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+	"os"
+	"strings"
+)
+
+const defaultLocale = "en-US"
+
+// symbolAfter lists the languages that write the currency after the amount.
+var symbolAfter = map[string]bool{
+	"cs": true, "da": true, "de": true, "es": true, "fi": true, "fr": true, "it": true,
+	"nb": true, "nl": true, "pl": true, "pt": true, "sk": true, "sv": true,
+}
+
+// Locale is the locale of notifications for staff and ambassadors,
+// configured with MAIL_LOCALE (e.g. "en-US").
+func Locale() string {
+	if locale := os.Getenv("MAIL_LOCALE"); locale != "" {
+		return locale
+	}
+	return defaultLocale
+}
+
+// LocaleFor guesses a customer's locale from the country of their address,
+// e.g. "de-DE" for "DE", falling back to Locale.
+func LocaleFor(country string) string {
+	region, err := language.ParseRegion(strings.TrimSpace(country))
+	if err != nil {
+		return Locale()
+	}
+
+	regional, err := language.Compose(region)
+	if err != nil {
+		return Locale()
+	}
+	base, confidence := regional.Base()
+	if confidence == language.No {
+		return Locale()
+	}
+
+	tag, err := language.Compose(base, region)
+	if err != nil {
+		return Locale()
+	}
+	return tag.String()
+}
+
+// FormatMoney writes an amount the way the locale does, e.g. $1,234.50 in
+// en-US or 1.234,50 € in de-DE. Unknown currencies are shown by their code.
+func FormatMoney(amount float64, currencyCode, locale string) string {
+	if amount < 0 {
+		return "-" + FormatMoney(-amount, currencyCode, locale)
+	}
+
+	tag, err := language.Parse(locale)
+	if err != nil {
+		tag = language.MustParse(defaultLocale)
+	}
+	printer := message.NewPrinter(tag)
+
+	symbol := strings.ToUpper(currencyCode)
+	if unit, err := currency.ParseISO(currencyCode); err == nil {
+		symbol = printer.Sprint(currency.Symbol(unit))
+	}
+
+	value := printer.Sprint(number.Decimal(amount, number.Scale(2)))
+
+	base, _ := tag.Base()
+	if symbolAfter[base.String()] {
+		return value + "\u00a0" + symbol
+	}
+	if len([]rune(symbol)) > 1 && !strings.ContainsAny(symbol, "$£¥₹") {
+		return symbol + "\u00a0" + value
+	}
+	return symbol + value
+}
@@ -0,0 +1,61 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	htmltemplate "html/template"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Each notification has a text template, which also defines its subject,
+// and an HTML template rendered inside the shared layout.
+//
+//go:embed templates
+var templates embed.FS
+
+// Render builds a message from the templates of a notification, formatting
+// money and dates for the locale.
+func Render(name, locale string, data interface{}) (Message, error) {
+	var message Message
+
+	funcs := map[string]interface{}{
+		"money": func(amount float64, currencyCode string) string {
+			return FormatMoney(amount, currencyCode, locale)
+		},
+		"date": func(t time.Time) string {
+			return t.Format("2 January 2006")
+		},
+	}
+
+	// Subject and plain text body
+	text, err := template.New(name+".txt").Funcs(funcs).ParseFS(templates, "templates/"+name+".txt")
+	if err != nil {
+		return message, err
+	}
+
+	var subject, body bytes.Buffer
+	if err := text.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return message, err
+	}
+	if err := text.Execute(&body, data); err != nil {
+		return message, err
+	}
+
+	// HTML body
+	html, err := htmltemplate.New("layout.html").Funcs(funcs).ParseFS(templates, "templates/layout.html", "templates/"+name+".html")
+	if err != nil {
+		return message, err
+	}
+
+	var htmlBody bytes.Buffer
+	if err := html.Execute(&htmlBody, data); err != nil {
+		return message, err
+	}
+
+	message.Subject = strings.TrimSpace(subject.String())
+	message.Text = strings.TrimSpace(body.String()) + "\n"
+	message.HTML = htmlBody.String()
+	return message, nil
+}
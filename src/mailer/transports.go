@@ -0,0 +1,154 @@
+package mailer
+
+import (
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/mail"
+	"net/smtp"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const dialTimeout = 10 * time.Second
+
+// SMTPTransport delivers messages to an SMTP server. Encryption is "none",
+// "starttls" or "tls" (implicit TLS, usually on port 465).
+type SMTPTransport struct {
+	Host       string
+	Port       string
+	Username   string
+	Password   string
+	Encryption string
+}
+
+// NewSMTPTransport reads the server from MAIL_HOST, MAIL_PORT, MAIL_USERNAME,
+// MAIL_PASSWORD and MAIL_ENCRYPTION.
+func NewSMTPTransport() *SMTPTransport {
+	t := &SMTPTransport{
+		Host:       os.Getenv("MAIL_HOST"),
+		Port:       os.Getenv("MAIL_PORT"),
+		Username:   os.Getenv("MAIL_USERNAME"),
+		Password:   os.Getenv("MAIL_PASSWORD"),
+		Encryption: strings.ToLower(os.Getenv("MAIL_ENCRYPTION")),
+	}
+	if t.Host == "" {
+		t.Host = "host.docker.internal"
+	}
+	if t.Port == "" {
+		t.Port = "1025"
+	}
+	return t
+}
+
+func (t *SMTPTransport) Send(message Message) error {
+	body, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(t.Host, t.Port)
+	tlsConfig := &tls.Config{ServerName: t.Host}
+	dialer := &net.Dialer{Timeout: dialTimeout}
+
+	var conn net.Conn
+	if t.Encryption == "tls" {
+		conn, err = tls.DialWithDialer(dialer, "tcp", addr, tlsConfig)
+	} else {
+		conn, err = dialer.Dial("tcp", addr)
+	}
+	if err != nil {
+		return err
+	}
+
+	client, err := smtp.NewClient(conn, t.Host)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer client.Close()
+
+	if t.Encryption == "starttls" {
+		if err := client.StartTLS(tlsConfig); err != nil {
+			return fmt.Errorf("starttls: %w", err)
+		}
+	}
+
+	if t.Username != "" {
+		if err := client.Auth(smtp.PlainAuth("", t.Username, t.Password, t.Host)); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err := client.Mail(address(message.From)); err != nil {
+		return err
+	}
+	for _, to := range message.To {
+		if err := client.Rcpt(address(to)); err != nil {
+			return err
+		}
+	}
+
+	writer, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := writer.Write(body); err != nil {
+		return err
+	}
+	if err := writer.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// FileTransport writes each message to an .eml file, for development.
+type FileTransport struct {
+	Dir string
+}
+
+func NewFileTransport(dir string) *FileTransport {
+	if dir == "" {
+		dir = "mail"
+	}
+	return &FileTransport{Dir: dir}
+}
+
+func (t *FileTransport) Send(message Message) error {
+	body, err := message.Bytes()
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(t.Dir, 0755); err != nil {
+		return err
+	}
+
+	suffix := make([]byte, 4)
+	rand.Read(suffix)
+	name := fmt.Sprintf("%s-%s.eml", time.Now().Format("20060102-150405"), hex.EncodeToString(suffix))
+
+	return os.WriteFile(filepath.Join(t.Dir, name), body, 0644)
+}
+
+// LogTransport only logs messages, for development and tests.
+type LogTransport struct{}
+
+func (LogTransport) Send(message Message) error {
+	log.Printf("Email to %s: %s\n%s", strings.Join(message.To, ", "), message.Subject, message.Text)
+	return nil
+}
+
+// address strips a display name, leaving the bare address for the envelope.
+func address(value string) string {
+	if parsed, err := mail.ParseAddress(value); err == nil {
+		return parsed.Address
+	}
+	return value
+}
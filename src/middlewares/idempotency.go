@@ -0,0 +1,129 @@
+package middlewares
+
+import (
+	"ambassador/src/database"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"log"
+	"time"
+)
+
+const (
+	IdempotencyHeader = "Idempotency-Key"
+
+	// idempotencyTTL is how long a completed response is replayed.
+	idempotencyTTL = 24 * time.Hour
+	// idempotencyLockTTL bounds how long an in-flight request holds the key.
+	idempotencyLockTTL = time.Minute
+)
+
+// idempotentResponse is the record stored for an Idempotency-Key.
+type idempotentResponse struct {
+	Fingerprint string `json:"fingerprint"`
+	Completed   bool   `json:"completed"`
+	Status      int    `json:"status"`
+	ContentType string `json:"content_type"`
+	Body        []byte `json:"body"`
+}
+
+// Idempotency replays the stored response when a request is retried with the
+// same Idempotency-Key header. Reusing a key with a different request body is
+// rejected, as is a retry while the first request is still running. Requests
+// without the header are passed through unchanged.
+func Idempotency(c *fiber.Ctx) error {
+	key := c.Get(IdempotencyHeader)
+	if key == "" {
+		return c.Next()
+	}
+	if len(key) > 255 {
+		return c.Status(fiber.StatusBadRequest).JSON(fiber.Map{
+			"message": "Idempotency-Key must be at most 255 characters",
+		})
+	}
+
+	ctx := context.Background()
+	cacheKey := "idempotency:" + c.Path() + ":" + key
+
+	// Fingerprint the request so a reused key with a different body is caught
+	hash := sha256.Sum256(append([]byte(c.Method()+" "+c.Path()+"\n"), c.Body()...))
+	fingerprint := hex.EncodeToString(hash[:])
+
+	lock, _ := json.Marshal(idempotentResponse{Fingerprint: fingerprint})
+	acquired, err := database.Cache.SetNX(ctx, cacheKey, lock, idempotencyLockTTL).Result()
+	if err != nil {
+		// Without Redis the request is processed normally
+		log.Printf("Failed to acquire idempotency key: %v", err)
+		return c.Next()
+	}
+
+	if !acquired {
+		return replay(c, cacheKey, fingerprint)
+	}
+
+	if err := c.Next(); err != nil {
+		database.Cache.Del(ctx, cacheKey)
+		return err
+	}
+
+	// Server errors are not stored so the client can retry them
+	status := c.Response().StatusCode()
+	if status >= fiber.StatusInternalServerError {
+		database.Cache.Del(ctx, cacheKey)
+		return nil
+	}
+
+	record, err := json.Marshal(idempotentResponse{
+		Fingerprint: fingerprint,
+		Completed:   true,
+		Status:      status,
+		ContentType: string(c.Response().Header.ContentType()),
+		Body:        c.Response().Body(),
+	})
+	if err != nil {
+		log.Printf("Failed to marshal idempotent response: %v", err)
+		return nil
+	}
+
+	if err := database.Cache.Set(ctx, cacheKey, record, idempotencyTTL).Err(); err != nil {
+		log.Printf("Failed to store idempotent response: %v", err)
+	}
+
+	return nil
+}
+
+// replay answers a retried request from the stored record.
+func replay(c *fiber.Ctx, cacheKey string, fingerprint string) error {
+	cached, err := database.Cache.Get(context.Background(), cacheKey).Bytes()
+	if err != nil {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": "A request with this Idempotency-Key is still in progress",
+		})
+	}
+
+	var record idempotentResponse
+	if err := json.Unmarshal(cached, &record); err != nil {
+		log.Printf("Failed to unmarshal idempotent response: %v", err)
+		return c.Status(fiber.StatusInternalServerError).JSON(fiber.Map{
+			"message": "Failed to process cached response",
+		})
+	}
+
+	if record.Fingerprint != fingerprint {
+		return c.Status(fiber.StatusUnprocessableEntity).JSON(fiber.Map{
+			"message": "Idempotency-Key was already used with a different request",
+		})
+	}
+
+	if !record.Completed {
+		return c.Status(fiber.StatusConflict).JSON(fiber.Map{
+			"message": "A request with this Idempotency-Key is still in progress",
+		})
+	}
+
+	c.Set("Idempotent-Replayed", "true")
+	c.Set(fiber.HeaderContentType, record.ContentType)
+	return c.Status(record.Status).Send(record.Body)
+}
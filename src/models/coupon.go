@@ -0,0 +1,47 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Coupon types.
+const (
+	CouponPercentage = "percentage"
+	CouponFixed      = "fixed"
+)
+
+// Coupon scopes.
+const (
+	CouponScopeCart    = "cart"
+	CouponScopeProduct = "product"
+)
+
+// Coupon is a discount code that can be applied at checkout.
+type Coupon struct {
+	Model
+	Code               string         `json:"code" gorm:"size:64;uniqueIndex"`
+	Type               string         `json:"type" gorm:"size:16"`
+	Value              float64        `json:"value"`
+	Scope              string         `json:"scope" gorm:"size:16;default:cart"`
+	Products           []Product      `json:"products" gorm:"many2many:coupon_products"`
+	MaxUses            uint           `json:"max_uses"`              // 0 means unlimited
+	MaxUsesPerCustomer uint           `json:"max_uses_per_customer"` // 0 means unlimited
+	StartsAt           *time.Time     `json:"starts_at" gorm:"null"`
+	EndsAt             *time.Time     `json:"ends_at" gorm:"null"`
+	LinkId             *uint          `json:"link_id" gorm:"null;index"` // restricts the coupon to one ambassador link
+	Active             bool           `json:"active"`
+	Uses               int64          `json:"uses" gorm:"-"`
+	CreatedAt          time.Time      `json:"created_at"`
+	DeletedAt          gorm.DeletedAt `json:"-" gorm:"index"`
+}
+
+// CouponRedemption records a coupon used on an order.
+type CouponRedemption struct {
+	Model
+	CouponId  uint      `json:"coupon_id" gorm:"index"`
+	OrderId   uint      `json:"order_id" gorm:"index"`
+	Email     string    `json:"email" gorm:"size:255;index"`
+	Discount  float64   `json:"discount"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import "time"
+
+// ExchangeRate converts the base currency into another currency.
+type ExchangeRate struct {
+	Model
+	Currency  string    `json:"currency" gorm:"size:3;uniqueIndex"`
+	Rate      float64   `json:"rate"` // units of Currency per unit of the base currency
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// ProductPrice overrides the converted base price of a product in a currency.
+type ProductPrice struct {
+	Model
+	ProductId uint    `json:"product_id" gorm:"uniqueIndex:idx_product_prices_product_currency"`
+	Currency  string  `json:"currency" gorm:"size:3;uniqueIndex:idx_product_prices_product_currency"`
+	Price     float64 `json:"price"`
+}
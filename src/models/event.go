@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Link event types, in funnel order.
+const (
+	EventClick    = "click"
+	EventCheckout = "checkout"
+	EventOrder    = "order"
+)
+
+// LinkEvent is a single step of the conversion funnel of a link.
+type LinkEvent struct {
+	Model
+	LinkId      uint      `json:"link_id" gorm:"index"`
+	Code        string    `json:"code" gorm:"size:64;index:idx_link_events_code_created,priority:1"`
+	Type        string    `json:"type" gorm:"size:16"`
+	VisitorId   string    `json:"visitor_id" gorm:"size:64"`
+	Referrer    string    `json:"referrer" gorm:"size:512"`
+	UserAgent   string    `json:"user_agent" gorm:"size:512"`
+	UtmSource   string    `json:"utm_source" gorm:"size:128"`
+	UtmMedium   string    `json:"utm_medium" gorm:"size:128"`
+	UtmCampaign string    `json:"utm_campaign" gorm:"size:128"`
+	UtmTerm     string    `json:"utm_term" gorm:"size:128"`
+	UtmContent  string    `json:"utm_content" gorm:"size:128"`
+	CreatedAt   time.Time `json:"created_at" gorm:"index:idx_link_events_code_created,priority:2"`
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Export job statuses.
+const (
+	ExportPending   = "pending"
+	ExportRunning   = "running"
+	ExportCompleted = "completed"
+	ExportFailed    = "failed"
+)
+
+// Export is an asynchronous export job and the file it produced.
+type Export struct {
+	Model
+	UserId      uint       `json:"user_id" gorm:"index"`
+	Type        string     `json:"type" gorm:"size:32"`
+	Format      string     `json:"format" gorm:"size:8"`
+	Filter      string     `json:"filter" gorm:"type:text"` // JSON-encoded filter of the export type
+	Status      string     `json:"status" gorm:"size:16;default:pending"`
+	Rows        int64      `json:"rows"`
+	Path        string     `json:"-"`
+	Error       string     `json:"error,omitempty"`
+	CreatedAt   time.Time  `json:"created_at"`
+	HeartbeatAt *time.Time `json:"-" gorm:"null"` // last sign of life from the instance running the job
+	CompletedAt *time.Time `json:"completed_at" gorm:"null"`
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// Invoice numbers paid orders sequentially, without gaps.
+type Invoice struct {
+	Model
+	OrderId  uint      `json:"order_id" gorm:"uniqueIndex"`
+	Number   uint      `json:"number" gorm:"uniqueIndex"`
+	IssuedAt time.Time `json:"issued_at"`
+}
+
+// Reference returns the invoice number as printed on the document.
+func (invoice *Invoice) Reference() string {
+	return fmt.Sprintf("INV-%06d", invoice.Number)
+}
@@ -1,10 +1,56 @@
 package models
 
+import (
+	"errors"
+	"gorm.io/gorm"
+	"time"
+)
+
+var (
+	ErrLinkPaused    = errors.New("link is paused")
+	ErrLinkExpired   = errors.New("link has expired")
+	ErrLinkExhausted = errors.New("link has reached its usage limit")
+	ErrLinkDeleted   = errors.New("link has been deleted")
+)
+
 type Link struct {
 	Model
-	Code     string    `json:"code"`
-	UserId   uint      `json:"user_id"`
-	User     User      `json:"user" gorm:"foreignKey:UserId"`
-	Products []Product `json:"products" gorm:"many2many:link_products"`
-	Orders   []Order   `json:"orders,omitempty" gorm:"-"`
+	Code             string         `json:"code" gorm:"size:64;uniqueIndex"`
+	UserId           uint           `json:"user_id"`
+	User             User           `json:"user" gorm:"foreignKey:UserId"`
+	Products         []Product      `json:"products" gorm:"many2many:link_products"`
+	Active           bool           `json:"active" gorm:"default:true"`
+	ExpiresAt        *time.Time     `json:"expires_at" gorm:"null"`
+	MaxUses          uint           `json:"max_uses"`               // 0 means unlimited
+	Currency         string         `json:"currency" gorm:"size:3"` // checkout default; empty uses the base currency
+	ExpiryNotifiedAt *time.Time     `json:"-" gorm:"null"`          // when the owner was told the link expired
+	Uses             int64          `json:"uses" gorm:"-"`
+	DeletedAt        gorm.DeletedAt `json:"-" gorm:"index"`
+	Orders           []Order        `json:"orders,omitempty" gorm:"-"`
+}
+
+// CheckAvailable reports why the link cannot be used for checkout, if at all.
+// uses is the number of completed orders placed through the link.
+func (link *Link) CheckAvailable(uses int64, now time.Time) error {
+	if link.DeletedAt.Valid {
+		return ErrLinkDeleted
+	}
+	if !link.Active {
+		return ErrLinkPaused
+	}
+	if link.ExpiresAt != nil && !now.Before(*link.ExpiresAt) {
+		return ErrLinkExpired
+	}
+	if link.MaxUses > 0 && uses >= int64(link.MaxUses) {
+		return ErrLinkExhausted
+	}
+	return nil
+}
+
+// IsUnavailable reports whether err is one of the link availability errors.
+func IsUnavailable(err error) bool {
+	return errors.Is(err, ErrLinkPaused) ||
+		errors.Is(err, ErrLinkExpired) ||
+		errors.Is(err, ErrLinkExhausted) ||
+		errors.Is(err, ErrLinkDeleted)
 }
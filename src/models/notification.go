@@ -0,0 +1,29 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Notification is a message shown in a user's in-app notification center.
+type Notification struct {
+	Model
+	UserId    uint            `json:"user_id" gorm:"index:idx_notifications_user_read,priority:1"`
+	Type      string          `json:"type" gorm:"size:64"`
+	Title     string          `json:"title"`
+	Body      string          `json:"body" gorm:"type:text"`
+	Data      json.RawMessage `json:"data" gorm:"type:text"` // JSON-encoded, specific to the type
+	ReadAt    *time.Time      `json:"read_at" gorm:"null;index:idx_notifications_user_read,priority:2"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NotificationPreference selects the channels a user is notified through for
+// one notification type. Types without a stored preference use every channel.
+type NotificationPreference struct {
+	Model
+	UserId  uint   `json:"-" gorm:"uniqueIndex:idx_notification_preferences_user_type,priority:1"`
+	Type    string `json:"type" gorm:"size:64;uniqueIndex:idx_notification_preferences_user_type,priority:2"`
+	Email   bool   `json:"email"`
+	InApp   bool   `json:"in_app"`
+	Webhook bool   `json:"webhook"`
+}
@@ -1,34 +1,131 @@
 package models
 
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Order statuses.
+const (
+	OrderPending           = "pending"
+	OrderPaid              = "paid"
+	OrderFailed            = "failed"
+	OrderExpired           = "expired"
+	OrderRefunded          = "refunded"
+	OrderPartiallyRefunded = "partially_refunded"
+	OrderCancelled         = "cancelled"
+)
+
+// OrderStatuses lists every order status.
+var OrderStatuses = []string{
+	OrderPending, OrderPaid, OrderFailed, OrderExpired, OrderRefunded, OrderPartiallyRefunded, OrderCancelled,
+}
+
+// RevenueStatuses are the statuses whose order items count towards revenue.
+var RevenueStatuses = []string{OrderPaid, OrderPartiallyRefunded}
+
+// LegacyOrderTime stands in for the creation and completion times of orders
+// placed before those were recorded. It precedes every real order, so they
+// sort and expire as the oldest and count towards all-time totals without
+// landing in any recent period.
+var LegacyOrderTime = time.Date(1970, time.January, 1, 0, 0, 0, 0, time.UTC)
+
+// orderTransitions lists the statuses each status may move to.
+var orderTransitions = map[string][]string{
+	OrderPending:           {OrderPaid, OrderFailed, OrderExpired, OrderCancelled},
+	OrderFailed:            {OrderPaid, OrderExpired, OrderCancelled},
+	OrderPaid:              {OrderRefunded, OrderPartiallyRefunded},
+	OrderPartiallyRefunded: {OrderPartiallyRefunded, OrderRefunded},
+}
+
+// Order history actors.
+const (
+	ActorSystem   = "system"
+	ActorCustomer = "customer"
+	ActorStripe   = "stripe"
+)
+
+// ActorAdmin identifies an admin user in the order history.
+func ActorAdmin(id uint) string {
+	return fmt.Sprintf("admin:%d", id)
+}
+
+// ErrInvalidTransition is returned when an order cannot move to the requested status.
+type ErrInvalidTransition struct {
+	From string
+	To   string
+}
+
+func (e ErrInvalidTransition) Error() string {
+	return fmt.Sprintf("order cannot move from %s to %s", e.From, e.To)
+}
+
 type Order struct {
 	Model
-	TransactionId   string      `json:"transaction_id" gorm:"null"`
-	UserId          uint        `json:"user_id"`
-	Code            string      `json:"code"`
-	AmbassadorEmail string      `json:"ambassador_email"`
-	FirstName       string      `json:"-"`
-	LastName        string      `json:"-"`
-	Name            string      `json:"name" gorm:"-"`
-	Email           string      `json:"email"`
-	Address         string      `json:"address" gorm:"null"`
-	City            string      `json:"city" gorm:"null"`
-	Country         string      `json:"country" gorm:"null"`
-	Zip             string      `json:"zip" gorm:"null"`
-	Complete        bool        `json:"-" gorm:"default:false"`
-	Total           float64     `json:"total" gorm:"-"`
-	OrderItems      []OrderItem `json:"order_items" gorm:"foreignKey:OrderId"`
+	TransactionId   string               `json:"transaction_id" gorm:"null"`
+	PaymentIntentId string               `json:"payment_intent_id" gorm:"null"`
+	UserId          uint                 `json:"user_id" gorm:"index"`
+	Code            string               `json:"code" gorm:"size:64;index"`
+	AmbassadorEmail string               `json:"ambassador_email"`
+	FirstName       string               `json:"-"`
+	LastName        string               `json:"-"`
+	Name            string               `json:"name" gorm:"-"`
+	Email           string               `json:"email" gorm:"size:255;index"`
+	Address         string               `json:"address" gorm:"null"`
+	City            string               `json:"city" gorm:"null"`
+	Country         string               `json:"country" gorm:"null"`
+	Region          string               `json:"region" gorm:"null"`
+	Zip             string               `json:"zip" gorm:"null"`
+	Status          string               `json:"status" gorm:"size:32;default:pending;index"`
+	CreatedAt       time.Time            `json:"created_at" gorm:"index"`
+	CompletedAt     *time.Time           `json:"completed_at" gorm:"null;index"`
+	FailedAt        *time.Time           `json:"failed_at" gorm:"null"`
+	ExpiredAt       *time.Time           `json:"expired_at" gorm:"null"`
+	RefundedAt      *time.Time           `json:"refunded_at" gorm:"null"`
+	CancelledAt     *time.Time           `json:"cancelled_at" gorm:"null"`
+	FlaggedAt       *time.Time           `json:"flagged_at" gorm:"null"` // paid in Stripe but never confirmed, left for an admin to review
+	RankedAt        *time.Time           `json:"-" gorm:"null"`          // when the commission was added to the leaderboards
+	CouponCode      string               `json:"coupon_code" gorm:"size:64"`
+	Discount        float64              `json:"discount"`
+	Tax             float64              `json:"tax"`
+	TaxInclusive    bool                 `json:"tax_inclusive"`
+	Shipping        float64              `json:"shipping"`
+	RefundedAmount  float64              `json:"refunded_amount"`
+	Currency        string               `json:"currency" gorm:"size:3"`
+	ReportingRate   float64              `json:"reporting_rate"`     // converts order amounts into the reporting currency
+	Total           float64              `json:"total" gorm:"index"` // items after discounts, without tax or shipping
+	OrderItems      []OrderItem          `json:"order_items" gorm:"foreignKey:OrderId"`
+	StatusHistory   []OrderStatusHistory `json:"status_history,omitempty" gorm:"foreignKey:OrderId"`
+	Refunds         []Refund             `json:"refunds,omitempty" gorm:"foreignKey:OrderId"`
 }
 
 type OrderItem struct {
 	Model
 	OrderId           uint    `json:"order_id"`
+	ProductId         uint    `json:"product_id"`
 	ProductTitle      string  `json:"product_title"`
+	Currency          string  `json:"currency" gorm:"size:3"`
 	Price             float64 `json:"price"`
 	Quantity          uint    `json:"quantity"`
+	Discount          float64 `json:"discount"`
+	Tax               float64 `json:"tax"`
+	RefundedQuantity  uint    `json:"refunded_quantity"`
 	AdminRevenue      float64 `json:"admin_revenue"`
 	AmbassadorRevenue float64 `json:"ambassador_revenue"`
 }
 
+// OrderStatusHistory records a single status change of an order.
+type OrderStatusHistory struct {
+	Model
+	OrderId    uint      `json:"order_id" gorm:"index"`
+	FromStatus string    `json:"from_status" gorm:"size:32"`
+	ToStatus   string    `json:"to_status" gorm:"size:32"`
+	Actor      string    `json:"actor" gorm:"size:64"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
 func (order *Order) FullName() string {
 	return order.FirstName + " " + order.LastName
 }
@@ -37,8 +134,106 @@ func (order *Order) GetTotal() float64 {
 	var total float64 = 0
 
 	for _, orderItem := range order.OrderItems {
-		total += orderItem.Price * float64(orderItem.Quantity)
+		total += orderItem.GetTotal()
 	}
 
 	return total
 }
+
+// GetChargedTotal returns what the customer was charged, including
+// exclusive tax and shipping.
+func (order *Order) GetChargedTotal() float64 {
+	total := order.GetTotal() + order.Shipping
+	if !order.TaxInclusive {
+		total += order.Tax
+	}
+	return total
+}
+
+// ReportingAmount converts an amount of the order into the reporting currency
+// at the rate fixed when the order was placed.
+func (order *Order) ReportingAmount(amount float64) float64 {
+	return amount * order.ReportingRate
+}
+
+// GetTotal returns the amount charged for the item after its discount.
+func (item *OrderItem) GetTotal() float64 {
+	return item.Price*float64(item.Quantity) - item.Discount
+}
+
+// CanTransition reports whether the order may move to the given status.
+func (order *Order) CanTransition(to string) bool {
+	for _, allowed := range orderTransitions[order.Status] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Transition moves the order to a new status, stamps the matching timestamp
+// and records the change in the status history. The update only applies if
+// the order is still in the status it was loaded with, so concurrent
+// transitions cannot both succeed.
+func (order *Order) Transition(db *gorm.DB, to string, actor string, reason string) error {
+	from := order.Status
+	if !order.CanTransition(to) {
+		return ErrInvalidTransition{From: from, To: to}
+	}
+
+	now := time.Now()
+	updates := map[string]interface{}{"status": to}
+	if column, ok := statusTimestamps[to]; ok {
+		updates[column] = now
+	}
+
+	return db.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(&Order{}).Where("id = ? AND status = ?", order.Id, from).Updates(updates)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInvalidTransition{From: from, To: to}
+		}
+
+		history := OrderStatusHistory{
+			OrderId:    order.Id,
+			FromStatus: from,
+			ToStatus:   to,
+			Actor:      actor,
+			Reason:     reason,
+		}
+		if err := tx.Create(&history).Error; err != nil {
+			return err
+		}
+
+		order.Status = to
+		order.setTimestamp(to, now)
+		return nil
+	})
+}
+
+// statusTimestamps maps a status to the column stamped when it is entered.
+var statusTimestamps = map[string]string{
+	OrderPaid:              "completed_at",
+	OrderFailed:            "failed_at",
+	OrderExpired:           "expired_at",
+	OrderRefunded:          "refunded_at",
+	OrderPartiallyRefunded: "refunded_at",
+	OrderCancelled:         "cancelled_at",
+}
+
+func (order *Order) setTimestamp(status string, at time.Time) {
+	switch status {
+	case OrderPaid:
+		order.CompletedAt = &at
+	case OrderFailed:
+		order.FailedAt = &at
+	case OrderExpired:
+		order.ExpiredAt = &at
+	case OrderRefunded, OrderPartiallyRefunded:
+		order.RefundedAt = &at
+	case OrderCancelled:
+		order.CancelledAt = &at
+	}
+}
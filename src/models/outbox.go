@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Outbox event statuses.
+const (
+	OutboxPending   = "pending"
+	OutboxDelivered = "delivered"
+	OutboxDead      = "dead"
+)
+
+// OutboxEvent is a side effect recorded in the same transaction as the change
+// that caused it, and carried out afterwards by the outbox dispatcher.
+type OutboxEvent struct {
+	Model
+	Type          string     `json:"type" gorm:"size:64;index"`
+	Payload       string     `json:"payload" gorm:"type:text"` // JSON-encoded, specific to the type
+	Status        string     `json:"status" gorm:"size:16;default:pending;index:idx_outbox_events_status_next_attempt,priority:1"`
+	Attempts      int        `json:"attempts"`
+	NextAttemptAt time.Time  `json:"next_attempt_at" gorm:"index:idx_outbox_events_status_next_attempt,priority:2"`
+	LastError     string     `json:"last_error,omitempty" gorm:"type:text"`
+	CreatedAt     time.Time  `json:"created_at"`
+	DeliveredAt   *time.Time `json:"delivered_at" gorm:"null"`
+}
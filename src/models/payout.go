@@ -0,0 +1,16 @@
+package models
+
+import "time"
+
+// Payout records commission paid out to an ambassador. Payouts are settled
+// outside the app, e.g. by bank transfer, and recorded by an admin afterwards.
+type Payout struct {
+	Model
+	UserId    uint      `json:"user_id" gorm:"index"`
+	Amount    float64   `json:"amount"`
+	Currency  string    `json:"currency" gorm:"size:3"`
+	Reference string    `json:"reference" gorm:"size:255"` // e.g. the bank transfer reference
+	Actor     string    `json:"actor" gorm:"size:64"`
+	PaidAt    time.Time `json:"paid_at"`
+	CreatedAt time.Time `json:"created_at"`
+}
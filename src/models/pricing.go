@@ -0,0 +1,27 @@
+package models
+
+// TaxRate is the tax charged for a country, optionally narrowed to a region.
+type TaxRate struct {
+	Model
+	Country   string  `json:"country" gorm:"size:2;uniqueIndex:idx_tax_rates_country_region"`
+	Region    string  `json:"region" gorm:"size:64;uniqueIndex:idx_tax_rates_country_region"` // empty applies to the whole country
+	Rate      float64 `json:"rate"`                                                           // fraction, e.g. 0.2 for 20%
+	Inclusive bool    `json:"inclusive"`                                                      // prices already contain the tax
+}
+
+// Shipping rule types.
+const (
+	ShippingFlat   = "flat"
+	ShippingWeight = "weight"
+)
+
+// ShippingRule prices shipping to a country, or to every country without a
+// more specific rule when Country is empty.
+type ShippingRule struct {
+	Model
+	Country  string  `json:"country" gorm:"size:2;uniqueIndex"`
+	Type     string  `json:"type" gorm:"size:16"`
+	Amount   float64 `json:"amount"`    // flat fee, or base fee for weight-based rules
+	PerKg    float64 `json:"per_kg"`    // added per kilogram for weight-based rules
+	FreeOver float64 `json:"free_over"` // subtotal from which shipping is free; 0 disables
+}
@@ -2,8 +2,10 @@ package models
 
 type Product struct {
 	Model
-	Title       string  `json:"title"`
-	Description string  `json:"description"`
-	Image       string  `json:"image"`
-	Price       float64 `json:"price"`
+	Title       string         `json:"title"`
+	Description string         `json:"description"`
+	Image       string         `json:"image"`
+	Price       float64        `json:"price"`  // in the base currency
+	Weight      float64        `json:"weight"` // in kilograms, used for shipping
+	Prices      []ProductPrice `json:"prices,omitempty" gorm:"foreignKey:ProductId"`
 }
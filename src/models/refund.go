@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// Refund records money returned to a customer and the revenue it reversed.
+type Refund struct {
+	Model
+	OrderId           uint         `json:"order_id" gorm:"index"`
+	StripeRefundId    *string      `json:"stripe_refund_id" gorm:"size:255;uniqueIndex"`
+	Amount            float64      `json:"amount"`
+	AmbassadorRevenue float64      `json:"ambassador_revenue"`
+	AdminRevenue      float64      `json:"admin_revenue"`
+	Reason            string       `json:"reason"`
+	Actor             string       `json:"actor" gorm:"size:64"`
+	CreatedAt         time.Time    `json:"created_at"`
+	RankedAt          *time.Time   `json:"-" gorm:"null"` // when the commission was taken off the leaderboards
+	RefundItems       []RefundItem `json:"refund_items" gorm:"foreignKey:RefundId"`
+}
+
+// RefundItem is the part of a refund attributed to one order item.
+type RefundItem struct {
+	Model
+	RefundId          uint    `json:"refund_id" gorm:"index"`
+	OrderItemId       uint    `json:"order_item_id"`
+	Quantity          uint    `json:"quantity"`
+	Amount            float64 `json:"amount"`
+	AmbassadorRevenue float64 `json:"ambassador_revenue"`
+	AdminRevenue      float64 `json:"admin_revenue"`
+}
@@ -12,7 +12,9 @@ type User struct {
 	Email        string   `json:"email" gorm:"unique"`
 	Password     []byte   `json:"-"`
 	IsAmbassador bool     `json:"-"`
-	Revenue      *float64 `json:"revenue,omitempty" gorm:"-"`
+	Revenue      *float64 `json:"revenue,omitempty" gorm:"-"` // in the reporting currency
+	// RevenueByCurrency holds the revenue in each order currency
+	RevenueByCurrency map[string]float64 `json:"revenue_by_currency,omitempty" gorm:"-"`
 }
 
 func (user *User) SetPassword(password string) {
@@ -33,20 +35,11 @@ type Admin User
 func (admin *Admin) CalculateRevenue(db *gorm.DB) {
 	var orders []Order
 
-	db.Preload("OrderItems").Find(&orders, &Order{
-		UserId:   admin.Id,
-		Complete: true,
-	})
-
-	var revenue float64 = 0
-
-	for _, order := range orders {
-		for _, orderItem := range order.OrderItems {
-			revenue += orderItem.AdminRevenue
-		}
-	}
+	db.Preload("OrderItems").Where("user_id = ? AND status IN ?", admin.Id, RevenueStatuses).Find(&orders)
 
-	admin.Revenue = &revenue
+	admin.Revenue, admin.RevenueByCurrency = sumRevenue(orders, func(item OrderItem) float64 {
+		return item.AdminRevenue
+	})
 }
 
 type Ambassador User
@@ -54,18 +47,31 @@ type Ambassador User
 func (ambassador *Ambassador) CalculateRevenue(db *gorm.DB) {
 	var orders []Order
 
-	db.Preload("OrderItems").Find(&orders, &Order{
-		UserId:   ambassador.Id,
-		Complete: true,
+	db.Preload("OrderItems").Where("user_id = ? AND status IN ?", ambassador.Id, RevenueStatuses).Find(&orders)
+
+	ambassador.SetRevenue(orders)
+}
+
+// SetRevenue totals the ambassador's commission on the given orders, which
+// must be loaded with their order items.
+func (ambassador *Ambassador) SetRevenue(orders []Order) {
+	ambassador.Revenue, ambassador.RevenueByCurrency = sumRevenue(orders, func(item OrderItem) float64 {
+		return item.AmbassadorRevenue
 	})
+}
 
-	var revenue float64 = 0.0
+// sumRevenue totals an item revenue in the reporting currency and per order currency.
+func sumRevenue(orders []Order, revenueOf func(OrderItem) float64) (*float64, map[string]float64) {
+	revenue := 0.0
+	byCurrency := make(map[string]float64)
 
 	for _, order := range orders {
 		for _, orderItem := range order.OrderItems {
-			revenue += orderItem.AmbassadorRevenue
+			amount := revenueOf(orderItem)
+			revenue += order.ReportingAmount(amount)
+			byCurrency[order.Currency] += amount
 		}
 	}
 
-	ambassador.Revenue = &revenue
+	return &revenue, byCurrency
 }
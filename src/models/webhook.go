@@ -0,0 +1,78 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// Webhook delivery statuses.
+const (
+	WebhookPending   = "pending"
+	WebhookSucceeded = "succeeded"
+	WebhookFailed    = "failed"
+)
+
+// WebhookEndpoint is a URL subscribed to events. Endpoints owned by an
+// ambassador receive the events of their own links and orders; endpoints
+// without an owner belong to partner integrations and receive every event.
+type WebhookEndpoint struct {
+	Model
+	UserId              uint       `json:"user_id" gorm:"index"`
+	URL                 string     `json:"url" gorm:"size:2048"`
+	Description         string     `json:"description" gorm:"size:255"`
+	Events              string     `json:"events" gorm:"size:255"` // comma-separated event types
+	Secret              string     `json:"-" gorm:"size:128"`
+	Active              bool       `json:"active" gorm:"default:true"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	DisabledAt          *time.Time `json:"disabled_at" gorm:"null"`
+	DisabledReason      string     `json:"disabled_reason,omitempty"`
+	CreatedAt           time.Time  `json:"created_at"`
+	UpdatedAt           time.Time  `json:"updated_at"`
+}
+
+// EventList returns the event types the endpoint is subscribed to.
+func (endpoint *WebhookEndpoint) EventList() []string {
+	if endpoint.Events == "" {
+		return []string{}
+	}
+	return strings.Split(endpoint.Events, ",")
+}
+
+// Subscribes reports whether the endpoint wants events of the given type.
+func (endpoint *WebhookEndpoint) Subscribes(eventType string) bool {
+	for _, event := range endpoint.EventList() {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery is one event sent to one endpoint, retried until it
+// succeeds or runs out of attempts.
+type WebhookDelivery struct {
+	Model
+	EndpointId     uint             `json:"endpoint_id" gorm:"index"`
+	EventId        string           `json:"event_id" gorm:"size:36;index"`
+	EventType      string           `json:"event_type" gorm:"size:64"`
+	Payload        string           `json:"payload" gorm:"type:text"`
+	Status         string           `json:"status" gorm:"size:16;default:pending;index:idx_webhook_deliveries_status_next_attempt,priority:1"`
+	Attempts       int              `json:"attempts"`
+	NextAttemptAt  time.Time        `json:"next_attempt_at" gorm:"index:idx_webhook_deliveries_status_next_attempt,priority:2"`
+	ResponseStatus int              `json:"response_status"`
+	LastError      string           `json:"last_error,omitempty" gorm:"type:text"`
+	CreatedAt      time.Time        `json:"created_at"`
+	DeliveredAt    *time.Time       `json:"delivered_at" gorm:"null"`
+	Log            []WebhookAttempt `json:"log,omitempty" gorm:"foreignKey:DeliveryId"`
+}
+
+// WebhookAttempt logs one HTTP request of a delivery.
+type WebhookAttempt struct {
+	Model
+	DeliveryId     uint      `json:"delivery_id" gorm:"index"`
+	ResponseStatus int       `json:"response_status"`
+	ResponseBody   string    `json:"response_body" gorm:"type:text"`
+	Error          string    `json:"error,omitempty" gorm:"type:text"`
+	DurationMs     int64     `json:"duration_ms"`
+	CreatedAt      time.Time `json:"created_at"`
+}
@@ -0,0 +1,75 @@
+package notifications
+
+import (
+	"ambassador/src/mailer"
+	"ambassador/src/models"
+	"fmt"
+	"gorm.io/gorm"
+)
+
+// OrderCompleted tells the ambassador what they earned from a paid order
+// loaded with its items.
+func OrderCompleted(tx *gorm.DB, order models.Order) error {
+	revenue := 0.0
+	for _, item := range order.OrderItems {
+		revenue += item.AmbassadorRevenue
+	}
+	earned := mailer.FormatMoney(revenue, order.Currency, mailer.Locale())
+
+	return Create(tx, order.UserId, TypeOrderCompleted,
+		fmt.Sprintf("You earned %s", earned),
+		fmt.Sprintf("Order #%d was placed through your link %s.", order.Id, order.Code),
+		map[string]interface{}{
+			"order_id": order.Id,
+			"code":     order.Code,
+			"currency": order.Currency,
+			"revenue":  revenue,
+		})
+}
+
+// OrderRefunded tells the ambassador how much commission a refund reversed.
+func OrderRefunded(tx *gorm.DB, order models.Order, refund models.Refund) error {
+	locale := mailer.Locale()
+
+	return Create(tx, order.UserId, TypeOrderRefunded,
+		fmt.Sprintf("Refund on order #%d", order.Id),
+		fmt.Sprintf("A refund of %s was issued on order #%d from your link %s. Your earnings were reduced by %s.",
+			mailer.FormatMoney(refund.Amount, order.Currency, locale), order.Id, order.Code,
+			mailer.FormatMoney(refund.AmbassadorRevenue, order.Currency, locale)),
+		map[string]interface{}{
+			"order_id":         order.Id,
+			"refund_id":        refund.Id,
+			"code":             order.Code,
+			"currency":         order.Currency,
+			"amount":           refund.Amount,
+			"revenue_reversed": refund.AmbassadorRevenue,
+		})
+}
+
+// LinkExpired tells the ambassador customers can no longer check out through
+// one of their links.
+func LinkExpired(tx *gorm.DB, link models.Link) error {
+	return Create(tx, link.UserId, TypeLinkExpired,
+		fmt.Sprintf("Link %s has expired", link.Code),
+		"Customers can no longer check out through this link. Set a new expiry date to reopen it.",
+		map[string]interface{}{
+			"link_id":    link.Id,
+			"code":       link.Code,
+			"expires_at": link.ExpiresAt,
+		})
+}
+
+// PayoutPaid tells the ambassador commission was paid out to them.
+func PayoutPaid(tx *gorm.DB, payout models.Payout) error {
+	paid := mailer.FormatMoney(payout.Amount, payout.Currency, mailer.Locale())
+
+	return Create(tx, payout.UserId, TypePayoutPaid,
+		fmt.Sprintf("You were paid %s", paid),
+		fmt.Sprintf("A payout of %s was sent to you.", paid),
+		map[string]interface{}{
+			"payout_id": payout.Id,
+			"currency":  payout.Currency,
+			"amount":    payout.Amount,
+			"reference": payout.Reference,
+		})
+}
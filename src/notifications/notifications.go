@@ -0,0 +1,195 @@
+package notifications
+
+import (
+	"ambassador/src/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"time"
+)
+
+// Notification types. They share their names with the webhook events
+// describing the same change.
+const (
+	TypeOrderCompleted = "order.completed"
+	TypeOrderRefunded  = "order.refunded"
+	TypeLinkExpired    = "link.expired"
+	TypePayoutPaid     = "payout.paid"
+)
+
+// Types lists every notification type a user can set preferences for.
+var Types = []string{TypeOrderCompleted, TypeOrderRefunded, TypeLinkExpired, TypePayoutPaid}
+
+// Channels a notification can be sent through.
+const (
+	ChannelEmail   = "email"
+	ChannelInApp   = "in_app"
+	ChannelWebhook = "webhook"
+)
+
+var ErrInvalidType = errors.New("unknown notification type")
+
+// ValidType reports whether the type is a notification type.
+func ValidType(notificationType string) bool {
+	for _, t := range Types {
+		if t == notificationType {
+			return true
+		}
+	}
+	return false
+}
+
+// Preference returns the user's channels for a notification type, defaulting
+// to every channel when none were chosen.
+func Preference(db *gorm.DB, userId uint, notificationType string) (models.NotificationPreference, error) {
+	preference := defaultPreference(userId, notificationType)
+
+	var stored []models.NotificationPreference
+	if err := db.Where("user_id = ? AND type = ?", userId, notificationType).Limit(1).Find(&stored).Error; err != nil {
+		return preference, err
+	}
+	if len(stored) > 0 {
+		preference = stored[0]
+	}
+
+	return preference, nil
+}
+
+// Preferences returns the user's channels for every notification type.
+func Preferences(db *gorm.DB, userId uint) ([]models.NotificationPreference, error) {
+	var stored []models.NotificationPreference
+	if err := db.Where("user_id = ?", userId).Find(&stored).Error; err != nil {
+		return nil, err
+	}
+
+	byType := make(map[string]models.NotificationPreference, len(stored))
+	for _, preference := range stored {
+		byType[preference.Type] = preference
+	}
+
+	preferences := make([]models.NotificationPreference, 0, len(Types))
+	for _, notificationType := range Types {
+		preference, ok := byType[notificationType]
+		if !ok {
+			preference = defaultPreference(userId, notificationType)
+		}
+		preferences = append(preferences, preference)
+	}
+
+	return preferences, nil
+}
+
+func defaultPreference(userId uint, notificationType string) models.NotificationPreference {
+	return models.NotificationPreference{UserId: userId, Type: notificationType, Email: true, InApp: true, Webhook: true}
+}
+
+// SetPreferences stores the user's channels for the given notification types,
+// leaving the other types unchanged.
+func SetPreferences(db *gorm.DB, userId uint, preferences []models.NotificationPreference) error {
+	if len(preferences) == 0 {
+		return nil
+	}
+
+	rows := make([]models.NotificationPreference, 0, len(preferences))
+	for _, preference := range preferences {
+		if !ValidType(preference.Type) {
+			return fmt.Errorf("%w: %s", ErrInvalidType, preference.Type)
+		}
+		rows = append(rows, models.NotificationPreference{
+			UserId:  userId,
+			Type:    preference.Type,
+			Email:   preference.Email,
+			InApp:   preference.InApp,
+			Webhook: preference.Webhook,
+		})
+	}
+
+	return db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "type"}},
+		DoUpdates: clause.AssignmentColumns([]string{"email", "in_app", "webhook"}),
+	}).Create(&rows).Error
+}
+
+// Allows reports whether the user wants notifications of the type sent
+// through the channel. Types that are not notification types are always
+// allowed.
+func Allows(db *gorm.DB, userId uint, notificationType, channel string) (bool, error) {
+	if !ValidType(notificationType) {
+		return true, nil
+	}
+
+	preference, err := Preference(db, userId, notificationType)
+	if err != nil {
+		return false, err
+	}
+
+	switch channel {
+	case ChannelEmail:
+		return preference.Email, nil
+	case ChannelInApp:
+		return preference.InApp, nil
+	case ChannelWebhook:
+		return preference.Webhook, nil
+	}
+	return false, fmt.Errorf("unknown notification channel %q", channel)
+}
+
+// Create adds a notification to the user's notification center unless they
+// turned in-app notifications of the type off. Pass the transaction of the
+// change the notification describes so both are committed together.
+func Create(tx *gorm.DB, userId uint, notificationType, title, body string, data interface{}) error {
+	allowed, err := Allows(tx, userId, notificationType, ChannelInApp)
+	if err != nil || !allowed {
+		return err
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(&models.Notification{
+		UserId: userId,
+		Type:   notificationType,
+		Title:  title,
+		Body:   body,
+		Data:   encoded,
+	}).Error
+}
+
+// MarkRead marks one of the user's notifications as read and returns it. A
+// notification that was already read keeps its original read time.
+func MarkRead(db *gorm.DB, userId, id uint) (models.Notification, error) {
+	var notification models.Notification
+	if err := db.Where("user_id = ?", userId).First(&notification, id).Error; err != nil {
+		return notification, err
+	}
+
+	if notification.ReadAt == nil {
+		now := time.Now()
+		if err := db.Model(&notification).Update("read_at", now).Error; err != nil {
+			return notification, err
+		}
+		notification.ReadAt = &now
+	}
+
+	return notification, nil
+}
+
+// MarkAllRead marks every unread notification of the user as read and
+// returns how many there were.
+func MarkAllRead(db *gorm.DB, userId uint) (int64, error) {
+	result := db.Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", userId).
+		Update("read_at", time.Now())
+	return result.RowsAffected, result.Error
+}
+
+// Unread counts the user's unread notifications.
+func Unread(db *gorm.DB, userId uint) (int64, error) {
+	var count int64
+	err := db.Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", userId).Count(&count).Error
+	return count, err
+}
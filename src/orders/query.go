@@ -0,0 +1,196 @@
+package orders
+
+import (
+	"ambassador/src/models"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultLimit = 50
+	MaxLimit     = 200
+)
+
+var (
+	ErrInvalidSort   = errors.New("sort must be one of created_at, total or id, optionally prefixed with -")
+	ErrInvalidCursor = errors.New("invalid cursor")
+)
+
+// Filter narrows down the orders that are listed or exported.
+type Filter struct {
+	Statuses []string   `json:"statuses,omitempty"`
+	UserId   uint       `json:"user_id,omitempty"`
+	Code     string     `json:"code,omitempty"`
+	From     *time.Time `json:"from,omitempty"` // inclusive
+	To       *time.Time `json:"to,omitempty"`   // exclusive
+	Email    string     `json:"email,omitempty"`
+	MinTotal *float64   `json:"min_total,omitempty"`
+	MaxTotal *float64   `json:"max_total,omitempty"`
+}
+
+// Apply adds the filter conditions to a query on the orders table.
+func (f Filter) Apply(query *gorm.DB) *gorm.DB {
+	if len(f.Statuses) > 0 {
+		query = query.Where("orders.status IN ?", f.Statuses)
+	}
+	if f.UserId != 0 {
+		query = query.Where("orders.user_id = ?", f.UserId)
+	}
+	if f.Code != "" {
+		query = query.Where("orders.code = ?", f.Code)
+	}
+	if f.From != nil {
+		query = query.Where("orders.created_at >= ?", *f.From)
+	}
+	if f.To != nil {
+		query = query.Where("orders.created_at < ?", *f.To)
+	}
+	if f.Email != "" {
+		query = query.Where("orders.email = ?", f.Email)
+	}
+	if f.MinTotal != nil {
+		query = query.Where("orders.total >= ?", *f.MinTotal)
+	}
+	if f.MaxTotal != nil {
+		query = query.Where("orders.total <= ?", *f.MaxTotal)
+	}
+	return query
+}
+
+// Sort orders a listing by a column, with the ID breaking ties.
+type Sort struct {
+	Field string
+	Desc  bool
+}
+
+// sortColumns are the columns a listing can be sorted by.
+var sortColumns = map[string]bool{"created_at": true, "total": true, "id": true}
+
+// ParseSort reads a sort such as "-created_at". An empty value sorts the
+// newest orders first.
+func ParseSort(value string) (Sort, error) {
+	if value == "" {
+		return Sort{Field: "created_at", Desc: true}, nil
+	}
+
+	sort := Sort{Field: strings.TrimPrefix(value, "-"), Desc: strings.HasPrefix(value, "-")}
+	if !sortColumns[sort.Field] {
+		return sort, ErrInvalidSort
+	}
+	return sort, nil
+}
+
+// String returns the sort in the form accepted by ParseSort.
+func (s Sort) String() string {
+	if s.Desc {
+		return "-" + s.Field
+	}
+	return s.Field
+}
+
+// Apply orders the query, breaking ties by ID in the same direction.
+func (s Sort) Apply(query *gorm.DB) *gorm.DB {
+	direction := "ASC"
+	if s.Desc {
+		direction = "DESC"
+	}
+	return query.Order(fmt.Sprintf("orders.%s %s, orders.id %s", s.Field, direction, direction))
+}
+
+// cursor marks the last order of a page by its sort value and ID.
+type cursor struct {
+	Value json.RawMessage `json:"v"`
+	Id    uint            `json:"id"`
+}
+
+// encodeCursor returns the cursor that continues after the order.
+func (s Sort) encodeCursor(order models.Order) string {
+	var value interface{}
+	switch s.Field {
+	case "created_at":
+		value = order.CreatedAt
+	case "total":
+		value = order.Total
+	default:
+		value = order.Id
+	}
+
+	raw, _ := json.Marshal(value)
+	data, _ := json.Marshal(cursor{Value: raw, Id: order.Id})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// after restricts the query to the orders that come after the cursor.
+func (s Sort) after(query *gorm.DB, encoded string) (*gorm.DB, error) {
+	data, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var value interface{}
+	switch s.Field {
+	case "created_at":
+		var t time.Time
+		err = json.Unmarshal(c.Value, &t)
+		value = t
+	case "total":
+		var total float64
+		err = json.Unmarshal(c.Value, &total)
+		value = total
+	default:
+		var id uint
+		err = json.Unmarshal(c.Value, &id)
+		value = id
+	}
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	op := ">"
+	if s.Desc {
+		op = "<"
+	}
+	column := "orders." + s.Field
+	condition := fmt.Sprintf("(%s %s ? OR (%s = ? AND orders.id %s ?))", column, op, column, op)
+	return query.Where(condition, value, value, c.Id), nil
+}
+
+// Page returns up to limit orders after the cursor and the cursor of the next
+// page, which is empty on the last page. db may carry preloads.
+func Page(db *gorm.DB, filter Filter, sort Sort, after string, limit int) ([]models.Order, string, error) {
+	if limit <= 0 || limit > MaxLimit {
+		limit = DefaultLimit
+	}
+
+	query := sort.Apply(filter.Apply(db.Model(&models.Order{})))
+	if after != "" {
+		var err error
+		if query, err = sort.after(query, after); err != nil {
+			return nil, "", err
+		}
+	}
+
+	// Fetch one extra order to know whether there is a next page
+	var page []models.Order
+	if err := query.Limit(limit + 1).Find(&page).Error; err != nil {
+		return nil, "", err
+	}
+
+	next := ""
+	if len(page) > limit {
+		page = page[:limit]
+		next = sort.encodeCursor(page[limit-1])
+	}
+
+	return page, next, nil
+}
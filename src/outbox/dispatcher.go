@@ -0,0 +1,34 @@
+package outbox
+
+import (
+	"ambassador/src/scheduler"
+	"context"
+	"log"
+	"time"
+)
+
+var dispatcher = scheduler.NewPoller("Outbox dispatcher", "OUTBOX_POLL_INTERVAL", 5*time.Second, dispatch)
+
+// StartDispatcher carries out outbox events in the background, polling every
+// OUTBOX_POLL_INTERVAL (default 5s) and whenever Wake is called.
+func StartDispatcher() {
+	dispatcher.Start()
+}
+
+// StopDispatcher stops the dispatcher and waits for the event in progress.
+func StopDispatcher() {
+	dispatcher.Stop()
+}
+
+// Wake asks the dispatcher to run now, e.g. right after events were committed.
+func Wake() {
+	dispatcher.Wake()
+}
+
+func dispatch(ctx context.Context) error {
+	report, err := Dispatch(ctx)
+	if report.Retried > 0 || report.Dead > 0 {
+		log.Printf("Outbox dispatch: %+v", report)
+	}
+	return err
+}
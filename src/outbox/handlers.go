@@ -0,0 +1,216 @@
+package outbox
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/invoices"
+	"ambassador/src/mailer"
+	"ambassador/src/models"
+	"ambassador/src/notifications"
+	"ambassador/src/rankings"
+	"ambassador/src/realtime"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+)
+
+// Side effects of a completed order. Each is its own event so that one
+// failing does not repeat the others.
+const (
+	EventOrderRankings        = "order.completed.rankings"
+	EventOrderAmbassadorEmail = "order.completed.ambassador_email"
+	EventOrderAdminEmail      = "order.completed.admin_email"
+	EventOrderInvoice         = "order.completed.invoice"
+
+	// EventRefundRankings takes a refund's commission off the leaderboards.
+	EventRefundRankings = "order.refunded.rankings"
+)
+
+var handlers = map[string]Handler{
+	EventOrderRankings:        incrementRankings,
+	EventOrderAmbassadorEmail: emailAmbassador,
+	EventOrderAdminEmail:      emailAdmin,
+	EventOrderInvoice:         sendInvoice,
+	EventRefundRankings:       clawBackRankings,
+}
+
+type orderPayload struct {
+	OrderId uint `json:"order_id"`
+	// AmbassadorRevenue is the commission when the order completed, in the
+	// order currency, before any refund reduced the item revenue.
+	AmbassadorRevenue *float64 `json:"ambassador_revenue,omitempty"`
+}
+
+// OrderCompleted returns the events to record when an order is paid.
+func OrderCompleted(order models.Order) ([]models.OutboxEvent, error) {
+	types := []string{EventOrderRankings, EventOrderAmbassadorEmail, EventOrderAdminEmail, EventOrderInvoice}
+	events := make([]models.OutboxEvent, 0, len(types))
+
+	ambassadorRevenue, _ := revenue(order)
+	for _, eventType := range types {
+		event, err := NewEvent(eventType, orderPayload{OrderId: order.Id, AmbassadorRevenue: &ambassadorRevenue})
+		if err != nil {
+			return nil, err
+		}
+		events = append(events, event)
+	}
+
+	return events, nil
+}
+
+type refundPayload struct {
+	RefundId uint `json:"refund_id"`
+}
+
+// RefundIssued returns the events to record when a refund is applied.
+func RefundIssued(refund models.Refund) ([]models.OutboxEvent, error) {
+	event, err := NewEvent(EventRefundRankings, refundPayload{RefundId: refund.Id})
+	if err != nil {
+		return nil, err
+	}
+	return []models.OutboxEvent{event}, nil
+}
+
+// loadOrder fetches the order of an order event with its items.
+func loadOrder(payload []byte) (models.Order, error) {
+	order, _, err := decodeOrder(payload)
+	return order, err
+}
+
+// decodeOrder fetches the order of an order event with its items and
+// returns the event data alongside.
+func decodeOrder(payload []byte) (models.Order, orderPayload, error) {
+	var order models.Order
+
+	var data orderPayload
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return order, data, fmt.Errorf("decode payload: %w", err)
+	}
+
+	err := database.DB.Preload("OrderItems").First(&order, data.OrderId).Error
+	return order, data, err
+}
+
+// revenue sums the ambassador and admin revenue of an order's items.
+func revenue(order models.Order) (float64, float64) {
+	ambassadorRevenue := 0.0
+	adminRevenue := 0.0
+	for _, item := range order.OrderItems {
+		ambassadorRevenue += item.AmbassadorRevenue
+		adminRevenue += item.AdminRevenue
+	}
+	return ambassadorRevenue, adminRevenue
+}
+
+// incrementRankings adds the commission to every leaderboard window, which
+// ranks in the reporting currency.
+func incrementRankings(ctx context.Context, payload []byte) error {
+	order, data, err := decodeOrder(payload)
+	if err != nil {
+		return err
+	}
+
+	completedAt := order.CreatedAt
+	if order.CompletedAt != nil {
+		completedAt = *order.CompletedAt
+	}
+
+	// Refunds are taken off separately, so rank the commission the order
+	// completed with. Events recorded without it add the refunds back.
+	var ambassadorRevenue float64
+	if data.AmbassadorRevenue != nil {
+		ambassadorRevenue = *data.AmbassadorRevenue
+	} else {
+		var refunded float64
+		if err := database.DB.Model(&models.Refund{}).Where("order_id = ?", order.Id).
+			Select("COALESCE(SUM(ambassador_revenue), 0)").Scan(&refunded).Error; err != nil {
+			return err
+		}
+		ambassadorRevenue, _ = revenue(order)
+		ambassadorRevenue += refunded
+	}
+
+	if err := rankings.RankOrder(ctx, order.Id, order.UserId, order.ReportingAmount(ambassadorRevenue), completedAt); err != nil {
+		return err
+	}
+
+	// The order is ranked now, so a failed publish is only logged
+	if err := realtime.PublishRankings(ctx, order.UserId); err != nil {
+		log.Printf("Failed to publish rankings of ambassador %d: %v", order.UserId, err)
+	}
+	return nil
+}
+
+// clawBackRankings takes the commission reversed by a refund off the windows
+// the refunded sale was counted in.
+func clawBackRankings(ctx context.Context, payload []byte) error {
+	var data refundPayload
+	if err := json.Unmarshal(payload, &data); err != nil {
+		return fmt.Errorf("decode payload: %w", err)
+	}
+
+	var refund models.Refund
+	if err := database.DB.First(&refund, data.RefundId).Error; err != nil {
+		return err
+	}
+	var order models.Order
+	if err := database.DB.First(&order, refund.OrderId).Error; err != nil {
+		return err
+	}
+
+	completedAt := order.CreatedAt
+	if order.CompletedAt != nil {
+		completedAt = *order.CompletedAt
+	}
+
+	if err := rankings.RankRefund(ctx, refund.Id, order.UserId, order.ReportingAmount(refund.AmbassadorRevenue), completedAt); err != nil {
+		return err
+	}
+
+	if err := realtime.PublishRankings(ctx, order.UserId); err != nil {
+		log.Printf("Failed to publish rankings of ambassador %d: %v", order.UserId, err)
+	}
+	return nil
+}
+
+func emailAmbassador(ctx context.Context, payload []byte) error {
+	order, err := loadOrder(payload)
+	if err != nil {
+		return err
+	}
+
+	allowed, err := notifications.Allows(database.DB, order.UserId, notifications.TypeOrderCompleted, notifications.ChannelEmail)
+	if err != nil || !allowed {
+		return err
+	}
+
+	ambassadorRevenue, _ := revenue(order)
+	return mailer.NotifyNow("ambassador_commission", mailer.Locale(), []string{order.AmbassadorEmail}, map[string]interface{}{
+		"Order":   &order,
+		"Revenue": ambassadorRevenue,
+	})
+}
+
+func emailAdmin(ctx context.Context, payload []byte) error {
+	order, err := loadOrder(payload)
+	if err != nil {
+		return err
+	}
+
+	_, adminRevenue := revenue(order)
+	return mailer.NotifyNow("order_completed", mailer.Locale(), []string{mailer.AdminAddress()}, map[string]interface{}{
+		"Order":   &order,
+		"Revenue": adminRevenue,
+	})
+}
+
+// sendInvoice issues the invoice and emails it to the customer. Issuing is
+// idempotent, so a retry sends the same invoice number.
+func sendInvoice(ctx context.Context, payload []byte) error {
+	order, err := loadOrder(payload)
+	if err != nil {
+		return err
+	}
+
+	return invoices.Send(order)
+}
@@ -0,0 +1,225 @@
+package outbox
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"ambassador/src/scheduler"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+const (
+	batchSize = 50
+
+	// MaxAttempts is how often an event is tried before it is dead-lettered.
+	MaxAttempts = 8
+
+	// lease is how long a claimed event is hidden from other dispatchers. An
+	// event whose dispatcher crashed is picked up again once it runs out.
+	lease = 5 * time.Minute
+
+	handlerTimeout = time.Minute
+	baseBackoff    = 10 * time.Second
+	maxBackoff     = time.Hour
+)
+
+// ErrNotReplayable is returned when replaying an event that is not dead.
+// Pending events are retried on their own, and may be leased to a dispatcher
+// that is running them right now.
+var ErrNotReplayable = errors.New("only dead events can be replayed")
+
+// Handler carries out the side effect of one type of event.
+type Handler func(ctx context.Context, payload []byte) error
+
+// Report summarises one dispatch run.
+type Report struct {
+	Delivered int `json:"delivered"`
+	Retried   int `json:"retried"`
+	Dead      int `json:"dead"`
+}
+
+// NewEvent encodes the payload of an event.
+func NewEvent(eventType string, payload interface{}) (models.OutboxEvent, error) {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return models.OutboxEvent{}, err
+	}
+
+	return models.OutboxEvent{
+		Type:          eventType,
+		Payload:       string(data),
+		Status:        models.OutboxPending,
+		NextAttemptAt: time.Now(),
+	}, nil
+}
+
+// Enqueue stores events with the transaction of the change that caused
+// them, so they are recorded if and only if the change is committed.
+func Enqueue(tx *gorm.DB, events ...models.OutboxEvent) error {
+	if len(events) == 0 {
+		return nil
+	}
+	return tx.Create(&events).Error
+}
+
+// Dispatch carries out every event that is due, oldest first, until none are
+// left or the context is cancelled.
+func Dispatch(ctx context.Context) (Report, error) {
+	var report Report
+	lastId := uint(0)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		var events []models.OutboxEvent
+		err := database.DB.
+			Where("status = ? AND next_attempt_at <= ? AND id > ?", models.OutboxPending, time.Now(), lastId).
+			Order("id").
+			Limit(batchSize).
+			Find(&events).Error
+		if err != nil {
+			return report, err
+		}
+		if len(events) == 0 {
+			return report, nil
+		}
+
+		for i := range events {
+			event := &events[i]
+			lastId = event.Id
+
+			claimed, err := claim(event)
+			if err != nil {
+				return report, err
+			}
+			if !claimed {
+				// Another dispatcher got to it first
+				continue
+			}
+
+			switch status, err := process(ctx, event); {
+			case err != nil:
+				log.Printf("Failed to update outbox event %d: %v", event.Id, err)
+			case status == models.OutboxDelivered:
+				report.Delivered++
+			case status == models.OutboxDead:
+				report.Dead++
+			default:
+				report.Retried++
+			}
+		}
+	}
+}
+
+// claim leases an event to this dispatcher and counts the attempt.
+func claim(event *models.OutboxEvent) (bool, error) {
+	claimed, err := scheduler.Claim(&models.OutboxEvent{}, event.Id, models.OutboxPending, lease)
+	if err != nil {
+		return false, err
+	}
+
+	event.Attempts++
+	return claimed, nil
+}
+
+// process runs the handler of an event and records the outcome, returning
+// the event's new status.
+func process(ctx context.Context, event *models.OutboxEvent) (string, error) {
+	err := handle(ctx, event)
+
+	updates := map[string]interface{}{}
+	switch {
+	case err == nil:
+		now := time.Now()
+		updates["status"] = models.OutboxDelivered
+		updates["delivered_at"] = now
+		updates["last_error"] = ""
+	case event.Attempts >= MaxAttempts:
+		log.Printf("Outbox event %d (%s) failed %d times, giving up: %v", event.Id, event.Type, event.Attempts, err)
+		updates["status"] = models.OutboxDead
+		updates["last_error"] = err.Error()
+	default:
+		updates["next_attempt_at"] = time.Now().Add(Backoff(event.Attempts))
+		updates["last_error"] = err.Error()
+	}
+
+	if err := database.DB.Model(event).Updates(updates).Error; err != nil {
+		return "", err
+	}
+	if status, ok := updates["status"].(string); ok {
+		return status, nil
+	}
+	return models.OutboxPending, nil
+}
+
+func handle(ctx context.Context, event *models.OutboxEvent) error {
+	handler, ok := handlers[event.Type]
+	if !ok {
+		return fmt.Errorf("no handler for outbox event type %q", event.Type)
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, handlerTimeout)
+	defer cancel()
+
+	return handler(ctx, []byte(event.Payload))
+}
+
+// Backoff returns the delay before the next attempt, doubling with every
+// failed attempt up to an hour.
+func Backoff(attempts int) time.Duration {
+	return scheduler.Backoff(attempts, baseBackoff, maxBackoff)
+}
+
+// Replay schedules a dead event to be tried again right away, with a fresh
+// set of attempts.
+func Replay(event *models.OutboxEvent) error {
+	if event.Status != models.OutboxDead {
+		return ErrNotReplayable
+	}
+
+	now := time.Now()
+	result := database.DB.Model(&models.OutboxEvent{}).
+		Where("id = ? AND status = ?", event.Id, models.OutboxDead).
+		Updates(map[string]interface{}{
+			"status":          models.OutboxPending,
+			"attempts":        0,
+			"next_attempt_at": now,
+		})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrNotReplayable
+	}
+
+	event.Status = models.OutboxPending
+	event.Attempts = 0
+	event.NextAttemptAt = now
+	Wake()
+	return nil
+}
+
+// ReplayDead schedules every dead event, optionally of one type, to be tried again.
+func ReplayDead(eventType string) (int64, error) {
+	query := database.DB.Model(&models.OutboxEvent{}).Where("status = ?", models.OutboxDead)
+	if eventType != "" {
+		query = query.Where("type = ?", eventType)
+	}
+
+	result := query.Updates(map[string]interface{}{
+		"status":          models.OutboxPending,
+		"attempts":        0,
+		"next_attempt_at": time.Now(),
+	})
+	if result.RowsAffected > 0 {
+		Wake()
+	}
+	return result.RowsAffected, result.Error
+}
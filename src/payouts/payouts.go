@@ -0,0 +1,81 @@
+package payouts
+
+import (
+	"ambassador/src/currency"
+	"ambassador/src/database"
+	"ambassador/src/mailer"
+	"ambassador/src/models"
+	"ambassador/src/notifications"
+	"ambassador/src/webhooks"
+	"errors"
+	"gorm.io/gorm"
+	"log"
+	"time"
+)
+
+var (
+	ErrInvalidAmount = errors.New("payout amount must be positive")
+	ErrNotAmbassador = errors.New("payouts can only be recorded for ambassadors")
+)
+
+// Record stores a payout that was settled outside the app and tells the
+// ambassador through the channels they chose. The currency defaults to the
+// reporting currency and the payment time to now.
+func Record(payout *models.Payout) error {
+	if payout.Amount <= 0 {
+		return ErrInvalidAmount
+	}
+
+	if payout.Currency == "" {
+		payout.Currency = currency.Reporting()
+	}
+	code, err := currency.Normalize(payout.Currency)
+	if err != nil {
+		return err
+	}
+	payout.Currency = code
+	payout.Amount = currency.Round(payout.Amount)
+
+	if payout.PaidAt.IsZero() {
+		payout.PaidAt = time.Now()
+	}
+
+	var ambassador models.User
+	if err := database.DB.Where("is_ambassador = ?", true).First(&ambassador, payout.UserId).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrNotAmbassador
+		}
+		return err
+	}
+
+	err = database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(payout).Error; err != nil {
+			return err
+		}
+		if err := notifications.PayoutPaid(tx, *payout); err != nil {
+			return err
+		}
+		return webhooks.Publish(tx, webhooks.EventPayoutPaid, payout.UserId, webhooks.PayoutPaid(*payout))
+	})
+	if err != nil {
+		return err
+	}
+	webhooks.Wake()
+
+	if err := sendEmail(ambassador, *payout); err != nil {
+		log.Printf("Failed to send payout email for payout %d: %v", payout.Id, err)
+	}
+	return nil
+}
+
+// sendEmail emails the ambassador unless they turned payout emails off.
+func sendEmail(ambassador models.User, payout models.Payout) error {
+	allowed, err := notifications.Allows(database.DB, ambassador.Id, notifications.TypePayoutPaid, notifications.ChannelEmail)
+	if err != nil || !allowed || ambassador.Email == "" {
+		return err
+	}
+
+	return mailer.Notify("payout_paid", mailer.Locale(), []string{ambassador.Email}, map[string]interface{}{
+		"Payout": &payout,
+	})
+}
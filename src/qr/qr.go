@@ -0,0 +1,197 @@
+package qr
+
+import (
+	"ambassador/src/database"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/skip2/go-qrcode"
+	"image"
+	"image/color"
+	"image/png"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	FormatPNG = "png"
+	FormatSVG = "svg"
+
+	MinSize       = 64
+	MaxSize       = 2048
+	DefaultSize   = 256
+	MaxMargin     = 16
+	DefaultMargin = 4
+
+	cacheTTL = 24 * time.Hour
+)
+
+var levels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// Options controls how a QR code is rendered.
+type Options struct {
+	Format string
+	Size   int    // width and height in pixels
+	Level  string // error correction level: L, M, Q or H
+	Margin int    // quiet zone in modules
+}
+
+// Validate checks the options and fills in defaults for unset values.
+func (o *Options) Validate() error {
+	if o.Format == "" {
+		o.Format = FormatPNG
+	}
+	if o.Format != FormatPNG && o.Format != FormatSVG {
+		return errors.New("format must be png or svg")
+	}
+
+	if o.Size == 0 {
+		o.Size = DefaultSize
+	}
+	if o.Size < MinSize || o.Size > MaxSize {
+		return fmt.Errorf("size must be between %d and %d", MinSize, MaxSize)
+	}
+
+	o.Level = strings.ToUpper(o.Level)
+	if o.Level == "" {
+		o.Level = "M"
+	}
+	if _, ok := levels[o.Level]; !ok {
+		return errors.New("level must be one of L, M, Q or H")
+	}
+
+	if o.Margin < 0 || o.Margin > MaxMargin {
+		return fmt.Errorf("margin must be between 0 and %d", MaxMargin)
+	}
+
+	return nil
+}
+
+// ContentType returns the MIME type of the rendered format.
+func (o *Options) ContentType() string {
+	if o.Format == FormatSVG {
+		return "image/svg+xml"
+	}
+	return "image/png"
+}
+
+// Render encodes content as a QR code in the requested format.
+func Render(content string, options Options) ([]byte, error) {
+	q, err := qrcode.New(content, levels[options.Level])
+	if err != nil {
+		return nil, err
+	}
+
+	// The margin is drawn here so it can be configured
+	q.DisableBorder = true
+	bitmap := q.Bitmap()
+
+	if options.Format == FormatSVG {
+		return renderSVG(bitmap, options), nil
+	}
+	return renderPNG(bitmap, options)
+}
+
+// RenderCached renders the QR code for a link, serving it from Redis when the
+// same variant was rendered before.
+func RenderCached(code string, content string, options Options) ([]byte, error) {
+	ctx := context.Background()
+	key := fmt.Sprintf("qr:%s:%s:%d:%s:%d", code, options.Format, options.Size, options.Level, options.Margin)
+
+	if cached, err := database.Cache.Get(ctx, key).Bytes(); err == nil {
+		return cached, nil
+	}
+
+	data, err := Render(content, options)
+	if err != nil {
+		return nil, err
+	}
+
+	// Remember every variant of the link so they can be invalidated together
+	pipe := database.Cache.TxPipeline()
+	pipe.Set(ctx, key, data, cacheTTL)
+	pipe.SAdd(ctx, variantsKey(code), key)
+	pipe.Expire(ctx, variantsKey(code), cacheTTL)
+	if _, err := pipe.Exec(ctx); err != nil {
+		log.Printf("Failed to cache QR code: %v", err)
+	}
+
+	return data, nil
+}
+
+// Invalidate removes every cached QR code variant of a link.
+func Invalidate(code string) {
+	ctx := context.Background()
+
+	keys, err := database.Cache.SMembers(ctx, variantsKey(code)).Result()
+	if err != nil {
+		log.Printf("Failed to fetch cached QR codes for %s: %v", code, err)
+		return
+	}
+
+	keys = append(keys, variantsKey(code))
+	if err := database.Cache.Del(ctx, keys...).Err(); err != nil {
+		log.Printf("Failed to clear cached QR codes for %s: %v", code, err)
+	}
+}
+
+func variantsKey(code string) string {
+	return "qr:" + code + ":variants"
+}
+
+func renderPNG(bitmap [][]bool, options Options) ([]byte, error) {
+	modules := len(bitmap) + 2*options.Margin
+	img := image.NewPaletted(image.Rect(0, 0, options.Size, options.Size), color.Palette{color.White, color.Black})
+
+	// Map every pixel back to its module so the image is exactly the requested size
+	for y := 0; y < options.Size; y++ {
+		row := y*modules/options.Size - options.Margin
+		for x := 0; x < options.Size; x++ {
+			col := x*modules/options.Size - options.Margin
+			if row >= 0 && row < len(bitmap) && col >= 0 && col < len(bitmap) && bitmap[row][col] {
+				img.SetColorIndex(x, y, 1)
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+func renderSVG(bitmap [][]bool, options Options) []byte {
+	modules := len(bitmap) + 2*options.Margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" viewBox="0 0 %d %d" shape-rendering="crispEdges">`,
+		options.Size, options.Size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="%d" height="%d" fill="#fff"/><path fill="#000" d="`, modules, modules)
+
+	// Emit one horizontal run per row segment to keep the path short
+	for y, row := range bitmap {
+		for x := 0; x < len(row); {
+			if !row[x] {
+				x++
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start+options.Margin, y+options.Margin, x-start, x-start)
+		}
+	}
+
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
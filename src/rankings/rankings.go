@@ -0,0 +1,204 @@
+package rankings
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"gorm.io/gorm"
+	"strconv"
+	"time"
+)
+
+// Leaderboard windows.
+const (
+	WindowDay   = "day"
+	WindowWeek  = "week"
+	WindowMonth = "month"
+	WindowAll   = "all"
+)
+
+// Windows lists every leaderboard window.
+var Windows = []string{WindowDay, WindowWeek, WindowMonth, WindowAll}
+
+// retention keeps past windows around for a while after they close.
+var retention = map[string]time.Duration{
+	WindowDay:   8 * 24 * time.Hour,
+	WindowWeek:  5 * 7 * 24 * time.Hour,
+	WindowMonth: 400 * 24 * time.Hour,
+}
+
+// ValidWindow reports whether w is a supported leaderboard window.
+func ValidWindow(w string) bool {
+	for _, window := range Windows {
+		if window == w {
+			return true
+		}
+	}
+	return false
+}
+
+// Period returns the identifier of the window containing t, e.g. 2024-W07.
+func Period(window string, t time.Time) string {
+	switch window {
+	case WindowDay:
+		return t.Format("2006-01-02")
+	case WindowWeek:
+		year, week := t.ISOWeek()
+		return fmt.Sprintf("%d-W%02d", year, week)
+	case WindowMonth:
+		return t.Format("2006-01")
+	}
+	return WindowAll
+}
+
+// Key returns the sorted set holding the window that contains t.
+func Key(window string, t time.Time) string {
+	if window == WindowAll {
+		return "rankings:all"
+	}
+	return "rankings:" + window + ":" + Period(window, t)
+}
+
+// Member encodes a user ID as a sorted set member. IDs are zero-padded so
+// that members with equal scores are ordered numerically by Redis.
+func Member(userId uint) string {
+	return fmt.Sprintf("%010d", userId)
+}
+
+// UserId decodes a sorted set member back into a user ID.
+func UserId(member string) (uint, error) {
+	id, err := strconv.ParseUint(member, 10, 64)
+	return uint(id), err
+}
+
+// writeLockKey serialises changes to the leaderboards, so a rebuild never
+// replaces a window while an order or refund is being applied to it.
+const writeLockKey = "rankings:write:lock"
+
+const (
+	writeLockTTL  = 5 * time.Minute
+	writeLockWait = 10 * time.Second
+)
+
+// RankOrder adds the commission of a completed order, in the reporting
+// currency, to every window containing at. Each order is counted once:
+// applying it again is a no-op.
+func RankOrder(ctx context.Context, orderId uint, userId uint, amount float64, at time.Time) error {
+	return apply(ctx, &models.Order{}, orderId, userId, amount, at)
+}
+
+// RankRefund takes the commission reversed by a refund, in the reporting
+// currency, off every window containing at, the completion time of the
+// refunded order. Each refund is counted once.
+func RankRefund(ctx context.Context, refundId uint, userId uint, amount float64, at time.Time) error {
+	return apply(ctx, &models.Refund{}, refundId, userId, -amount, at)
+}
+
+// apply marks the order or refund as ranked and increments the leaderboards
+// together, holding the write lock so Rebuild sees either both or neither.
+func apply(ctx context.Context, model interface{}, id uint, userId uint, amount float64, at time.Time) error {
+	lock, err := database.WaitLock(ctx, writeLockKey, writeLockTTL, writeLockWait)
+	if err != nil {
+		return err
+	}
+	defer lock.Release()
+
+	return database.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(model).Where("id = ? AND ranked_at IS NULL", id).Update("ranked_at", time.Now())
+		if result.Error != nil || result.RowsAffected == 0 {
+			return result.Error
+		}
+
+		// A failed increment rolls the marker back so the change is retried
+		return increment(ctx, userId, amount, at)
+	})
+}
+
+// increment adds revenue earned at the given time to every window.
+func increment(ctx context.Context, userId uint, amount float64, at time.Time) error {
+	pipe := database.Cache.TxPipeline()
+
+	for _, window := range Windows {
+		key := Key(window, at)
+		pipe.ZIncrBy(ctx, key, amount, Member(userId))
+		if ttl, ok := retention[window]; ok {
+			pipe.Expire(ctx, key, ttl)
+		}
+	}
+
+	_, err := pipe.Exec(ctx)
+	return err
+}
+
+// Entry is a single leaderboard position.
+type Entry struct {
+	Rank    int64   `json:"rank"`
+	UserId  uint    `json:"user_id"`
+	Revenue float64 `json:"revenue"`
+}
+
+// Page returns one page of the leaderboard ordered by revenue. Ambassadors
+// with equal revenue share a rank and are listed by descending user ID.
+func Page(ctx context.Context, key string, page int, perPage int) ([]Entry, int64, error) {
+	total, err := database.Cache.ZCard(ctx, key).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	start := int64((page - 1) * perPage)
+	members, err := database.Cache.ZRevRangeWithScores(ctx, key, start, start+int64(perPage)-1).Result()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	entries := make([]Entry, 0, len(members))
+	var previousRank int64
+	for i, member := range members {
+		// Competition ranking: ties share the rank of the first tied position.
+		// Ranks are tracked for skipped members too, since they hold a position.
+		rank := start + int64(i) + 1
+		if i > 0 && member.Score == members[i-1].Score {
+			rank = previousRank
+		} else if i == 0 && start > 0 {
+			if rank, err = rankOf(ctx, key, member.Score); err != nil {
+				return nil, 0, err
+			}
+		}
+		previousRank = rank
+
+		id, err := UserId(member.Member.(string))
+		if err != nil {
+			continue
+		}
+
+		entries = append(entries, Entry{Rank: rank, UserId: id, Revenue: member.Score})
+	}
+
+	return entries, total, nil
+}
+
+// Position returns the user's rank and revenue in the leaderboard, or a zero
+// rank when the user has not earned anything in the window.
+func Position(ctx context.Context, key string, userId uint) (Entry, error) {
+	entry := Entry{UserId: userId}
+
+	score, err := database.Cache.ZScore(ctx, key, Member(userId)).Result()
+	if err == redis.Nil {
+		return entry, nil
+	}
+	if err != nil {
+		return entry, err
+	}
+
+	entry.Revenue = score
+	entry.Rank, err = rankOf(ctx, key, score)
+	return entry, err
+}
+
+// rankOf counts the members scoring strictly higher than score.
+func rankOf(ctx context.Context, key string, score float64) (int64, error) {
+	higher, err := database.Cache.ZCount(ctx, key, "("+strconv.FormatFloat(score, 'f', -1, 64), "+inf").Result()
+	return higher + 1, err
+}
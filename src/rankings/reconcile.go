@@ -0,0 +1,211 @@
+package rankings
+
+import (
+	"ambassador/src/database"
+	"context"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"math"
+	"time"
+)
+
+// driftTolerance ignores rounding differences between Redis and SQL sums.
+const driftTolerance = 0.005
+
+// Drift describes a leaderboard member whose Redis score disagrees with the database.
+type Drift struct {
+	UserId   uint    `json:"user_id"`
+	Redis    float64 `json:"redis"`
+	Database float64 `json:"database"`
+}
+
+// Report summarizes a rebuild of one leaderboard window.
+type Report struct {
+	Window  string  `json:"window"`
+	Key     string  `json:"key"`
+	Members int     `json:"members"`
+	Missing []Drift `json:"missing"` // in the database but not in Redis
+	Stale   []Drift `json:"stale"`   // in Redis but not in the database
+	Changed []Drift `json:"changed"` // present in both with different scores
+}
+
+// HasDrift reports whether Redis disagreed with the database.
+func (r Report) HasDrift() bool {
+	return len(r.Missing)+len(r.Stale)+len(r.Changed) > 0
+}
+
+// Rebuild recomputes the window containing at from SQL, writes it to a
+// temporary key and atomically swaps it in, reporting how the previous Redis
+// contents drifted from the database. It holds the write lock throughout so
+// no order or refund is applied between the snapshot and the swap.
+func Rebuild(ctx context.Context, window string, at time.Time) (Report, error) {
+	key := Key(window, at)
+	report := Report{Window: window, Key: key}
+
+	lock, err := database.WaitLock(ctx, writeLockKey, writeLockTTL, writeLockWait)
+	if err != nil {
+		return report, err
+	}
+	defer lock.Release()
+
+	expected, err := revenueByAmbassador(window, at)
+	if err != nil {
+		return report, err
+	}
+	report.Members = len(expected)
+
+	// Compare against the live leaderboard before replacing it
+	live, err := database.Cache.ZRangeWithScores(ctx, key, 0, -1).Result()
+	if err != nil {
+		return report, err
+	}
+
+	seen := make(map[uint]bool, len(live))
+	for _, z := range live {
+		id, err := UserId(z.Member.(string))
+		if err != nil {
+			// Legacy members such as display names are always stale
+			report.Stale = append(report.Stale, Drift{Redis: z.Score})
+			continue
+		}
+		seen[id] = true
+
+		revenue, ok := expected[id]
+		if !ok {
+			report.Stale = append(report.Stale, Drift{UserId: id, Redis: z.Score})
+		} else if math.Abs(revenue-z.Score) > driftTolerance {
+			report.Changed = append(report.Changed, Drift{UserId: id, Redis: z.Score, Database: revenue})
+		}
+	}
+
+	for id, revenue := range expected {
+		if !seen[id] {
+			report.Missing = append(report.Missing, Drift{UserId: id, Database: revenue})
+		}
+	}
+
+	// Build the new leaderboard next to the live one
+	tmpKey := fmt.Sprintf("%s:rebuild:%d", key, time.Now().UnixNano())
+	if len(expected) > 0 {
+		members := make([]redis.Z, 0, len(expected))
+		for id, revenue := range expected {
+			members = append(members, redis.Z{Score: revenue, Member: Member(id)})
+		}
+		if err := database.Cache.ZAdd(ctx, tmpKey, members...).Err(); err != nil {
+			return report, err
+		}
+	}
+
+	// Swap it in atomically; an empty result simply removes the live key
+	pipe := database.Cache.TxPipeline()
+	if len(expected) > 0 {
+		pipe.Rename(ctx, tmpKey, key)
+		if ttl, ok := retention[window]; ok {
+			pipe.Expire(ctx, key, ttl)
+		}
+	} else {
+		pipe.Del(ctx, key)
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		database.Cache.Del(ctx, tmpKey)
+		return report, err
+	}
+
+	return report, nil
+}
+
+// RebuildAll rebuilds every window containing at.
+func RebuildAll(ctx context.Context, at time.Time) ([]Report, error) {
+	reports := make([]Report, 0, len(Windows))
+
+	for _, window := range Windows {
+		report, err := Rebuild(ctx, window, at)
+		if err != nil {
+			return reports, fmt.Errorf("rebuild %s rankings: %w", window, err)
+		}
+		reports = append(reports, report)
+	}
+
+	return reports, nil
+}
+
+// revenueByAmbassador sums the commission the leaderboards should hold per
+// ambassador within the window containing at, in the reporting currency:
+// that of ranked orders before any refund, less the refunds already taken
+// off. Orders and refunds still waiting in the outbox are left out, as they
+// are not in Redis yet either.
+func revenueByAmbassador(window string, at time.Time) (map[uint]float64, error) {
+	type row struct {
+		UserId  uint
+		Revenue float64
+	}
+
+	// Item revenue is reduced by refunds, so add them back for the original commission
+	ranked := database.DB.Table("orders AS o").
+		Select("o.user_id, SUM((COALESCE(i.revenue, 0) + COALESCE(r.revenue, 0)) * o.reporting_rate) AS revenue").
+		Joins("JOIN users u ON u.id = o.user_id AND u.is_ambassador = ?", true).
+		Joins("LEFT JOIN (SELECT order_id, SUM(ambassador_revenue) AS revenue FROM order_items GROUP BY order_id) i ON i.order_id = o.id").
+		Joins("LEFT JOIN (SELECT order_id, SUM(ambassador_revenue) AS revenue FROM refunds GROUP BY order_id) r ON r.order_id = o.id").
+		Where("o.ranked_at IS NOT NULL").
+		Group("o.user_id")
+
+	clawedBack := database.DB.Table("refunds AS r").
+		Select("o.user_id, SUM(r.ambassador_revenue * o.reporting_rate) AS revenue").
+		Joins("JOIN orders o ON o.id = r.order_id").
+		Joins("JOIN users u ON u.id = o.user_id AND u.is_ambassador = ?", true).
+		Where("r.ranked_at IS NOT NULL").
+		Group("o.user_id")
+
+	if window != WindowAll {
+		from, to := bounds(window, at)
+		ranked = ranked.Where("o.completed_at >= ? AND o.completed_at < ?", from, to)
+		clawedBack = clawedBack.Where("o.completed_at >= ? AND o.completed_at < ?", from, to)
+	}
+
+	var earned, reversed []row
+	if err := ranked.Scan(&earned).Error; err != nil {
+		return nil, err
+	}
+	if err := clawedBack.Scan(&reversed).Error; err != nil {
+		return nil, err
+	}
+
+	revenue := make(map[uint]float64, len(earned))
+	for _, r := range earned {
+		revenue[r.UserId] += r.Revenue
+	}
+	for _, r := range reversed {
+		revenue[r.UserId] -= r.Revenue
+	}
+
+	return revenue, nil
+}
+
+// bounds returns the start (inclusive) and end (exclusive) of the window containing t.
+func bounds(window string, t time.Time) (time.Time, time.Time) {
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, t.Location())
+
+	switch window {
+	case WindowWeek:
+		start := day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+		return start, start.AddDate(0, 0, 7)
+	case WindowMonth:
+		start := time.Date(t.Year(), t.Month(), 1, 0, 0, 0, 0, t.Location())
+		return start, start.AddDate(0, 1, 0)
+	}
+
+	return day, day.AddDate(0, 0, 1)
+}
+
+// LogReports writes a summary line per rebuilt window.
+func LogReports(reports []Report) {
+	for _, report := range reports {
+		if report.HasDrift() {
+			log.Printf("Rebuilt %s rankings (%d members): %d missing, %d stale, %d changed",
+				report.Window, report.Members, len(report.Missing), len(report.Stale), len(report.Changed))
+		} else {
+			log.Printf("Rebuilt %s rankings (%d members): no drift", report.Window, report.Members)
+		}
+	}
+}
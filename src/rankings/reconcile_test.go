@@ -0,0 +1,91 @@
+package rankings
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"github.com/google/uuid"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"os"
+	"testing"
+	"time"
+)
+
+// useTestDatabase points the database package at the MySQL database in
+// TEST_DATABASE_DSN, e.g. "root:root@tcp(localhost:3306)/ambassador_test?parseTime=True&loc=Local",
+// and migrates it, skipping the test when it is not set.
+func useTestDatabase(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatalf("Failed to connect to the test database: %v", err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+
+	database.AutoMigrate()
+}
+
+// A paid order from before orders had creation or completion times, left
+// without either by an earlier migration, still counts towards all-time
+// revenue once the database is migrated again, and only there.
+func TestRebuildKeepsLegacyRevenue(t *testing.T) {
+	useTestDatabase(t)
+
+	ambassador := models.User{FirstName: "Legacy", LastName: "Ambassador", Email: uuid.NewString() + "@example.com", IsAmbassador: true}
+	if err := database.DB.Create(&ambassador).Error; err != nil {
+		t.Fatalf("Failed to create ambassador: %v", err)
+	}
+
+	err := database.DB.Exec(`INSERT INTO orders (user_id, code, status, currency, reporting_rate, created_at, completed_at)
+		VALUES (?, 'legacy', ?, 'USD', 1, NULL, NULL)`, ambassador.Id, models.OrderPaid).Error
+	if err != nil {
+		t.Fatalf("Failed to create legacy order: %v", err)
+	}
+	var order models.Order
+	if err := database.DB.Where("user_id = ?", ambassador.Id).First(&order).Error; err != nil {
+		t.Fatalf("Failed to fetch legacy order: %v", err)
+	}
+	item := models.OrderItem{OrderId: order.Id, ProductTitle: "Legacy product", Price: 100, Quantity: 1, AmbassadorRevenue: 10, AdminRevenue: 90}
+	if err := database.DB.Create(&item).Error; err != nil {
+		t.Fatalf("Failed to create legacy order item: %v", err)
+	}
+
+	t.Cleanup(func() {
+		database.DB.Delete(&item)
+		database.DB.Delete(&models.Order{}, order.Id)
+		database.DB.Delete(&ambassador)
+	})
+
+	database.AutoMigrate()
+
+	database.DB.First(&order, order.Id)
+	if !order.CreatedAt.Equal(models.LegacyOrderTime) || order.CompletedAt == nil || order.RankedAt == nil {
+		t.Fatalf("legacy order = created %v, completed %v, ranked %v, want the legacy order time",
+			order.CreatedAt, order.CompletedAt, order.RankedAt)
+	}
+
+	all, err := revenueByAmbassador(WindowAll, time.Now())
+	if err != nil {
+		t.Fatalf("revenueByAmbassador: %v", err)
+	}
+	if all[ambassador.Id] != 10 {
+		t.Errorf("all-time revenue = %v, want the legacy order's 10", all[ambassador.Id])
+	}
+
+	for _, window := range []string{WindowDay, WindowWeek, WindowMonth} {
+		revenue, err := revenueByAmbassador(window, time.Now())
+		if err != nil {
+			t.Fatalf("revenueByAmbassador(%s): %v", window, err)
+		}
+		if revenue[ambassador.Id] != 0 {
+			t.Errorf("%s revenue = %v, want the legacy order left out", window, revenue[ambassador.Id])
+		}
+	}
+}
@@ -0,0 +1,22 @@
+package rankings
+
+import (
+	"ambassador/src/scheduler"
+	"context"
+	"time"
+)
+
+// RebuildJob periodically rebuilds every leaderboard window. The interval is
+// read from RANKINGS_REBUILD_INTERVAL (e.g. "1h").
+var RebuildJob = scheduler.Job{
+	Name:        "Rankings rebuild",
+	IntervalEnv: "RANKINGS_REBUILD_INTERVAL",
+	LockKey:     "rankings:rebuild:lock",
+	Run:         rebuild,
+}
+
+func rebuild(ctx context.Context) error {
+	reports, err := RebuildAll(ctx, time.Now())
+	LogReports(reports)
+	return err
+}
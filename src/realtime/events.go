@@ -0,0 +1,79 @@
+package realtime
+
+import (
+	"ambassador/src/models"
+	"ambassador/src/rankings"
+	"context"
+	"time"
+)
+
+// Event types streamed to the dashboards.
+const (
+	EventOrderCreated    = "order.created"
+	EventOrderCompleted  = "order.completed"
+	EventRankingsUpdated = "rankings.updated"
+)
+
+// OrderData describes an order without customer details, which is all the
+// ambassador dashboards show.
+type OrderData struct {
+	OrderId           uint       `json:"order_id"`
+	Code              string     `json:"code"`
+	AmbassadorId      uint       `json:"ambassador_id"`
+	Status            string     `json:"status"`
+	Currency          string     `json:"currency"`
+	Total             float64    `json:"total"`
+	AmbassadorRevenue float64    `json:"ambassador_revenue"`
+	CreatedAt         time.Time  `json:"created_at"`
+	CompletedAt       *time.Time `json:"completed_at"`
+}
+
+// RankingsData is an ambassador's position in every leaderboard window.
+type RankingsData struct {
+	AmbassadorId uint                      `json:"ambassador_id"`
+	Windows      map[string]rankings.Entry `json:"windows"`
+}
+
+// PublishOrder sends an order event to the admins and to the ambassador
+// whose link the order came from.
+func PublishOrder(ctx context.Context, eventType string, order models.Order) error {
+	data := OrderData{
+		OrderId:      order.Id,
+		Code:         order.Code,
+		AmbassadorId: order.UserId,
+		Status:       order.Status,
+		Currency:     order.Currency,
+		Total:        order.GetChargedTotal(),
+		CreatedAt:    order.CreatedAt,
+		CompletedAt:  order.CompletedAt,
+	}
+	for _, item := range order.OrderItems {
+		data.AmbassadorRevenue += item.AmbassadorRevenue
+	}
+
+	return publishToBoth(ctx, order.UserId, eventType, data)
+}
+
+// PublishRankings sends an ambassador's current leaderboard positions after
+// their revenue changed.
+func PublishRankings(ctx context.Context, userId uint) error {
+	now := time.Now()
+	data := RankingsData{AmbassadorId: userId, Windows: make(map[string]rankings.Entry, len(rankings.Windows))}
+
+	for _, window := range rankings.Windows {
+		entry, err := rankings.Position(ctx, rankings.Key(window, now), userId)
+		if err != nil {
+			return err
+		}
+		data.Windows[window] = entry
+	}
+
+	return publishToBoth(ctx, userId, EventRankingsUpdated, data)
+}
+
+func publishToBoth(ctx context.Context, userId uint, eventType string, data interface{}) error {
+	if err := Publish(ctx, AdminStream, eventType, data); err != nil {
+		return err
+	}
+	return Publish(ctx, AmbassadorStream(userId), eventType, data)
+}
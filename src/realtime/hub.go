@@ -0,0 +1,109 @@
+package realtime
+
+import (
+	"ambassador/src/database"
+	"context"
+	"encoding/json"
+	"github.com/redis/go-redis/v9"
+	"log"
+	"strings"
+	"sync"
+)
+
+// subscriberBuffer is how many events a slow client may fall behind before
+// it is disconnected. It resumes from its last event when it reconnects.
+const subscriberBuffer = 64
+
+var (
+	mu          sync.Mutex
+	subscribers = map[string]map[chan Event]struct{}{}
+	pubsub      *redis.PubSub
+	closed      bool
+)
+
+// Setup subscribes this instance to the events published by every instance
+// and hands them to the local subscribers of each stream.
+func Setup() {
+	pubsub = database.Cache.PSubscribe(context.Background(), keyPrefix+"*")
+
+	go func(messages <-chan *redis.Message) {
+		for message := range messages {
+			var event Event
+			if err := json.Unmarshal([]byte(message.Payload), &event); err != nil {
+				log.Printf("Failed to decode realtime event: %v", err)
+				continue
+			}
+			event.Stream = strings.TrimPrefix(message.Channel, keyPrefix)
+			broadcast(event)
+		}
+	}(pubsub.Channel())
+}
+
+// Close disconnects every subscriber so open streams end, which lets the
+// server shut down.
+func Close() {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if pubsub != nil {
+		pubsub.Close()
+	}
+	for stream, channels := range subscribers {
+		for ch := range channels {
+			close(ch)
+		}
+		delete(subscribers, stream)
+	}
+	closed = true
+}
+
+// Subscribe returns a channel receiving the live events of a stream and a
+// function to stop receiving them. The channel is closed when the client
+// falls too far behind or the server shuts down.
+func Subscribe(stream string) (<-chan Event, func()) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	ch := make(chan Event, subscriberBuffer)
+	if closed {
+		close(ch)
+		return ch, func() {}
+	}
+
+	if subscribers[stream] == nil {
+		subscribers[stream] = map[chan Event]struct{}{}
+	}
+	subscribers[stream][ch] = struct{}{}
+
+	return ch, func() {
+		mu.Lock()
+		defer mu.Unlock()
+		remove(stream, ch)
+	}
+}
+
+func broadcast(event Event) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for ch := range subscribers[event.Stream] {
+		select {
+		case ch <- event:
+		default:
+			log.Printf("Realtime subscriber of %s fell behind, disconnecting", event.Stream)
+			remove(event.Stream, ch)
+		}
+	}
+}
+
+// remove closes a subscriber's channel; the caller holds mu.
+func remove(stream string, ch chan Event) {
+	if _, ok := subscribers[stream][ch]; !ok {
+		return
+	}
+	delete(subscribers[stream], ch)
+	close(ch)
+	if len(subscribers[stream]) == 0 {
+		delete(subscribers, stream)
+	}
+}
@@ -0,0 +1,128 @@
+package realtime
+
+import (
+	"ambassador/src/database"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/redis/go-redis/v9"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// AdminStream carries the events of every ambassador.
+	AdminStream = "admin"
+
+	// HeartbeatInterval keeps idle connections open through proxies.
+	HeartbeatInterval = 15 * time.Second
+	// RetryInterval tells clients how long to wait before reconnecting.
+	RetryInterval = 3 * time.Second
+
+	// Recent events are kept in a Redis stream per scope so that a client
+	// reconnecting with Last-Event-ID receives what it missed.
+	historyLength = 1000
+	historyTTL    = 24 * time.Hour
+
+	keyPrefix = "realtime:"
+)
+
+// Event is a dashboard update. Its ID is the Redis stream ID, so IDs of one
+// stream increase over time.
+type Event struct {
+	Id     string          `json:"id"`
+	Stream string          `json:"stream"`
+	Type   string          `json:"type"`
+	Data   json.RawMessage `json:"data"`
+}
+
+// AmbassadorStream carries the events of one ambassador's links.
+func AmbassadorStream(userId uint) string {
+	return fmt.Sprintf("ambassador:%d", userId)
+}
+
+// Publish appends an event to a stream's history and broadcasts it to every
+// API instance over Redis pub/sub.
+func Publish(ctx context.Context, stream string, eventType string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	key := keyPrefix + stream
+	id, err := database.Cache.XAdd(ctx, &redis.XAddArgs{
+		Stream: key,
+		MaxLen: historyLength,
+		Approx: true,
+		Values: map[string]interface{}{"type": eventType, "data": string(payload)},
+	}).Result()
+	if err != nil {
+		return err
+	}
+	database.Cache.Expire(ctx, key, historyTTL)
+
+	message, err := json.Marshal(Event{Id: id, Stream: stream, Type: eventType, Data: payload})
+	if err != nil {
+		return err
+	}
+	return database.Cache.Publish(ctx, key, message).Err()
+}
+
+// Since returns the events of a stream published after the given ID, oldest
+// first. Unknown or malformed IDs yield no events.
+func Since(ctx context.Context, stream string, lastId string) ([]Event, error) {
+	if _, _, ok := parseId(lastId); !ok {
+		return nil, nil
+	}
+
+	messages, err := database.Cache.XRangeN(ctx, keyPrefix+stream, "("+lastId, "+", historyLength).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make([]Event, 0, len(messages))
+	for _, message := range messages {
+		eventType, _ := message.Values["type"].(string)
+		data, _ := message.Values["data"].(string)
+		events = append(events, Event{Id: message.ID, Stream: stream, Type: eventType, Data: json.RawMessage(data)})
+	}
+	return events, nil
+}
+
+// After reports whether stream ID a comes after b. Every ID comes after an
+// empty or malformed one.
+func After(a, b string) bool {
+	bMs, bSeq, ok := parseId(b)
+	if !ok {
+		return true
+	}
+	aMs, aSeq, ok := parseId(a)
+	if !ok {
+		return false
+	}
+	return aMs > bMs || (aMs == bMs && aSeq > bSeq)
+}
+
+// parseId splits a Redis stream ID of the form "<milliseconds>-<sequence>".
+func parseId(id string) (uint64, uint64, bool) {
+	ms, seq, found := strings.Cut(id, "-")
+	if !found {
+		return 0, 0, false
+	}
+
+	msValue, err := strconv.ParseUint(ms, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	seqValue, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil {
+		return 0, 0, false
+	}
+	return msValue, seqValue, true
+}
+
+// Format encodes the event in the text/event-stream format.
+func (e Event) Format() string {
+	return fmt.Sprintf("id: %s\nevent: %s\ndata: %s\n\n", e.Id, e.Type, e.Data)
+}
@@ -0,0 +1,455 @@
+package refunds
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/mailer"
+	"ambassador/src/models"
+	"ambassador/src/notifications"
+	"ambassador/src/outbox"
+	"ambassador/src/webhooks"
+	"errors"
+	"fmt"
+	"github.com/stripe/stripe-go/v81"
+	"github.com/stripe/stripe-go/v81/checkout/session"
+	"github.com/stripe/stripe-go/v81/refund"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"log"
+	"math"
+	"os"
+	"strconv"
+)
+
+// sourceMetadata marks refunds created through the API in Stripe. They are
+// recorded like any other refund: the Stripe webhook skips a refund only once
+// its Stripe ID is stored, so a refund that failed to be recorded here is
+// picked up from the webhook.
+const sourceMetadata = "ambassador_api"
+
+var (
+	ErrNotRefundable   = errors.New("order cannot be refunded in its current status")
+	ErrNothingToRefund = errors.New("nothing left to refund on this order")
+	ErrInvalidItem     = errors.New("order item does not belong to this order")
+	ErrInvalidQuantity = errors.New("refund quantity exceeds the refundable quantity")
+)
+
+// ItemRequest asks for a number of units of an order item to be refunded.
+type ItemRequest struct {
+	OrderItemId uint `json:"order_item_id"`
+	Quantity    uint `json:"quantity"`
+}
+
+// Issue refunds the requested items through Stripe and reverses the revenue
+// they generated. When items is empty everything still refundable is refunded.
+// The order row is locked from planning until the refund is recorded, so
+// concurrent refunds of the same order are validated one after the other.
+func Issue(order *models.Order, items []ItemRequest, reason string, actor string) (*models.Refund, error) {
+	var record *models.Refund
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockOrder(tx, order); err != nil {
+			return err
+		}
+		if !refundable(order) {
+			return ErrNotRefundable
+		}
+
+		var err error
+		record, err = planItems(order, items)
+		if err != nil {
+			return err
+		}
+		record.Reason = reason
+		record.Actor = actor
+
+		paymentIntentId, err := paymentIntent(tx, order)
+		if err != nil {
+			return err
+		}
+
+		// Refund the customer before touching revenue so a failed payout changes nothing
+		params := &stripe.RefundParams{
+			PaymentIntent: stripe.String(paymentIntentId),
+			Amount:        stripe.Int64(toCents(record.Amount)),
+		}
+		params.AddMetadata("order_id", strconv.Itoa(int(order.Id)))
+		params.AddMetadata("source", sourceMetadata)
+
+		stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+		stripeRefund, err := refund.New(params)
+		if err != nil {
+			return err
+		}
+		record.StripeRefundId = &stripeRefund.ID
+
+		if err := save(tx, order, record); err != nil {
+			// The Stripe webhook records it from the refund list instead
+			log.Printf("Stripe refund %s issued but not recorded for order %d: %v", stripeRefund.ID, order.Id, err)
+			return err
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	applied(order, record)
+	return record, nil
+}
+
+// ApplyExternal records a refund made outside the API, for example from the
+// Stripe dashboard. The refunded amount reverses revenue proportionally
+// across the order items. Refunds that were already recorded are skipped
+// and return nil.
+func ApplyExternal(order *models.Order, stripeRefundId string, amount float64, reason string) (*models.Refund, error) {
+	var record *models.Refund
+
+	err := database.DB.Transaction(func(tx *gorm.DB) error {
+		if err := lockOrder(tx, order); err != nil {
+			return err
+		}
+
+		// An API refund still being recorded holds the lock until it is stored
+		var count int64
+		if err := tx.Model(&models.Refund{}).Where("stripe_refund_id = ?", stripeRefundId).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			return nil
+		}
+
+		if !refundable(order) {
+			return ErrNotRefundable
+		}
+
+		remaining := order.GetChargedTotal() - order.RefundedAmount
+		if remaining <= 0 {
+			return ErrNothingToRefund
+		}
+		ratio := math.Min(amount/remaining, 1)
+
+		record = &models.Refund{
+			OrderId:        order.Id,
+			StripeRefundId: &stripeRefundId,
+			Amount:         amount,
+			Reason:         reason,
+			Actor:          models.ActorStripe,
+		}
+
+		for _, item := range order.OrderItems {
+			line := models.RefundItem{
+				OrderItemId:       item.Id,
+				Amount:            roundCents(unitPaid(order, item) * float64(item.Quantity-item.RefundedQuantity) * ratio),
+				AmbassadorRevenue: item.AmbassadorRevenue * ratio,
+				AdminRevenue:      item.AdminRevenue * ratio,
+			}
+			// Only a complete refund can be attributed to units
+			if ratio == 1 {
+				line.Quantity = item.Quantity - item.RefundedQuantity
+			}
+			record.AmbassadorRevenue += line.AmbassadorRevenue
+			record.AdminRevenue += line.AdminRevenue
+			record.RefundItems = append(record.RefundItems, line)
+		}
+
+		return save(tx, order, record)
+	})
+	if err != nil || record == nil {
+		return nil, err
+	}
+
+	applied(order, record)
+	return record, nil
+}
+
+// SyncPaymentIntent applies every succeeded Stripe refund of a payment intent
+// that has not been recorded yet, whether it was made through the API or not.
+func SyncPaymentIntent(paymentIntentId string) error {
+	order, err := findOrderByPaymentIntent(paymentIntentId)
+	if err != nil {
+		return err
+	}
+
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+	iter := refund.List(&stripe.RefundListParams{PaymentIntent: stripe.String(paymentIntentId)})
+
+	for iter.Next() {
+		stripeRefund := iter.Refund()
+		if stripeRefund.Status != stripe.RefundStatusSucceeded {
+			continue
+		}
+
+		var count int64
+		if err := database.DB.Model(&models.Refund{}).Where("stripe_refund_id = ?", stripeRefund.ID).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		if _, err := ApplyExternal(&order, stripeRefund.ID, float64(stripeRefund.Amount)/100, "Refunded in Stripe"); err != nil {
+			if errors.Is(err, gorm.ErrDuplicatedKey) {
+				continue
+			}
+			return err
+		}
+	}
+
+	return iter.Err()
+}
+
+// lockOrder reloads the order with its items and locks its row until the
+// transaction ends.
+func lockOrder(tx *gorm.DB, order *models.Order) error {
+	return tx.Clauses(clause.Locking{Strength: "UPDATE"}).Preload("OrderItems").First(order, order.Id).Error
+}
+
+// planItems builds the refund for the requested items.
+func planItems(order *models.Order, items []ItemRequest) (*models.Refund, error) {
+	// Merge repeated items and default to everything that is left
+	requested := make(map[uint]uint)
+	for _, item := range items {
+		requested[item.OrderItemId] += item.Quantity
+	}
+	if len(items) == 0 {
+		for _, item := range order.OrderItems {
+			requested[item.Id] = item.Quantity - item.RefundedQuantity
+		}
+	}
+
+	record := &models.Refund{OrderId: order.Id}
+	found := 0
+
+	for _, item := range order.OrderItems {
+		quantity, ok := requested[item.Id]
+		if !ok {
+			continue
+		}
+		found++
+
+		remaining := item.Quantity - item.RefundedQuantity
+		if quantity > remaining {
+			return nil, ErrInvalidQuantity
+		}
+		if quantity == 0 {
+			continue
+		}
+
+		// Reverse the revenue still attributed to the remaining units
+		line := models.RefundItem{
+			OrderItemId:       item.Id,
+			Quantity:          quantity,
+			Amount:            unitPaid(order, item) * float64(quantity),
+			AmbassadorRevenue: item.AmbassadorRevenue * float64(quantity) / float64(remaining),
+			AdminRevenue:      item.AdminRevenue * float64(quantity) / float64(remaining),
+		}
+
+		record.Amount += line.Amount
+		record.AmbassadorRevenue += line.AmbassadorRevenue
+		record.AdminRevenue += line.AdminRevenue
+		record.RefundItems = append(record.RefundItems, line)
+	}
+
+	if found != len(requested) {
+		return nil, ErrInvalidItem
+	}
+	if len(record.RefundItems) == 0 {
+		return nil, ErrNothingToRefund
+	}
+
+	// A full refund also returns shipping
+	if len(items) == 0 {
+		record.Amount += order.Shipping
+	}
+
+	// Earlier amount-based refunds may already cover part of the items
+	record.Amount = roundCents(math.Min(record.Amount, order.GetChargedTotal()-order.RefundedAmount))
+	if record.Amount <= 0 {
+		return nil, ErrNothingToRefund
+	}
+
+	return record, nil
+}
+
+// save stores the refund, reverses the item revenue and moves the order to
+// its refunded status, recording the rankings update in the outbox.
+func save(tx *gorm.DB, order *models.Order, record *models.Refund) error {
+	refundedQuantities := make(map[uint]uint)
+	for _, line := range record.RefundItems {
+		refundedQuantities[line.OrderItemId] = line.Quantity
+	}
+
+	// The order is fully refunded once every unit or the whole total is refunded
+	fullyRefunded := true
+	for _, item := range order.OrderItems {
+		if item.RefundedQuantity+refundedQuantities[item.Id] < item.Quantity {
+			fullyRefunded = false
+		}
+	}
+	if order.RefundedAmount+record.Amount >= order.GetChargedTotal()-0.005 {
+		fullyRefunded = true
+	}
+
+	status := models.OrderPartiallyRefunded
+	if fullyRefunded {
+		status = models.OrderRefunded
+	}
+
+	if err := tx.Create(record).Error; err != nil {
+		return err
+	}
+
+	for _, line := range record.RefundItems {
+		if err := tx.Model(&models.OrderItem{}).Where("id = ?", line.OrderItemId).Updates(map[string]interface{}{
+			"refunded_quantity":  gorm.Expr("refunded_quantity + ?", line.Quantity),
+			"ambassador_revenue": gorm.Expr("ambassador_revenue - ?", line.AmbassadorRevenue),
+			"admin_revenue":      gorm.Expr("admin_revenue - ?", line.AdminRevenue),
+		}).Error; err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Model(&models.Order{}).Where("id = ?", order.Id).
+		Update("refunded_amount", gorm.Expr("refunded_amount + ?", record.Amount)).Error; err != nil {
+		return err
+	}
+
+	reason := fmt.Sprintf("Refunded %.2f %s", record.Amount, order.Currency)
+	if record.Reason != "" {
+		reason += ": " + record.Reason
+	}
+	if err := order.Transition(tx, status, record.Actor, reason); err != nil {
+		return err
+	}
+	if err := notifications.OrderRefunded(tx, *order, *record); err != nil {
+		return err
+	}
+
+	events, err := outbox.RefundIssued(*record)
+	if err != nil {
+		return err
+	}
+	if err := outbox.Enqueue(tx, events...); err != nil {
+		return err
+	}
+
+	return webhooks.Publish(tx, webhooks.EventOrderRefunded, order.UserId, webhooks.OrderRefunded(*order, *record))
+}
+
+// applied runs once a saved refund is committed: it keeps the in-memory order
+// in sync, wakes the dispatchers and notifies the ambassador.
+func applied(order *models.Order, record *models.Refund) {
+	outbox.Wake()
+	webhooks.Wake()
+
+	// Keep the in-memory order in sync with what was stored
+	order.RefundedAmount += record.Amount
+	for i, item := range order.OrderItems {
+		for _, line := range record.RefundItems {
+			if line.OrderItemId == item.Id {
+				order.OrderItems[i].RefundedQuantity += line.Quantity
+				order.OrderItems[i].AmbassadorRevenue -= line.AmbassadorRevenue
+				order.OrderItems[i].AdminRevenue -= line.AdminRevenue
+			}
+		}
+	}
+
+	notifyAmbassador(*order, *record)
+}
+
+func notifyAmbassador(order models.Order, record models.Refund) {
+	allowed, err := notifications.Allows(database.DB, order.UserId, notifications.TypeOrderRefunded, notifications.ChannelEmail)
+	if err != nil {
+		log.Printf("Failed to fetch notification preferences of ambassador %d: %v", order.UserId, err)
+	}
+	if !allowed {
+		return
+	}
+
+	err = mailer.Notify("refund_issued", mailer.Locale(), []string{order.AmbassadorEmail}, map[string]interface{}{
+		"Order":  &order,
+		"Refund": &record,
+	})
+	if err != nil {
+		log.Printf("Failed to send refund email to ambassador: %v", err)
+	}
+}
+
+// unitPaid returns what the customer paid per unit after discounts,
+// including tax when it was charged on top of the price.
+func unitPaid(order *models.Order, item models.OrderItem) float64 {
+	total := item.GetTotal()
+	if !order.TaxInclusive {
+		total += item.Tax
+	}
+	return total / float64(item.Quantity)
+}
+
+func refundable(order *models.Order) bool {
+	return order.CanTransition(models.OrderRefunded) || order.CanTransition(models.OrderPartiallyRefunded)
+}
+
+// paymentIntent returns the payment intent of the order's checkout session,
+// looking it up in Stripe the first time and remembering it on the order.
+func paymentIntent(db *gorm.DB, order *models.Order) (string, error) {
+	if order.PaymentIntentId != "" {
+		return order.PaymentIntentId, nil
+	}
+
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+	checkout, err := session.Get(order.TransactionId, nil)
+	if err != nil {
+		return "", err
+	}
+	if checkout.PaymentIntent == nil {
+		return "", fmt.Errorf("checkout session %s has no payment intent", order.TransactionId)
+	}
+
+	order.PaymentIntentId = checkout.PaymentIntent.ID
+	if err := db.Model(&models.Order{}).Where("id = ?", order.Id).Update("payment_intent_id", order.PaymentIntentId).Error; err != nil {
+		log.Printf("Failed to store payment intent for order %d: %v", order.Id, err)
+	}
+
+	return order.PaymentIntentId, nil
+}
+
+// findOrderByPaymentIntent loads the order paid with the payment intent.
+func findOrderByPaymentIntent(paymentIntentId string) (models.Order, error) {
+	var order models.Order
+
+	err := database.DB.Preload("OrderItems").Where("payment_intent_id = ?", paymentIntentId).First(&order).Error
+	if err == nil {
+		return order, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return order, err
+	}
+
+	// Fall back to the checkout session, which is what the order references
+	stripe.Key = os.Getenv("STRIPE_SECRET_KEY")
+	iter := session.List(&stripe.CheckoutSessionListParams{PaymentIntent: stripe.String(paymentIntentId)})
+	for iter.Next() {
+		err := database.DB.Preload("OrderItems").Where("transaction_id = ?", iter.CheckoutSession().ID).First(&order).Error
+		if err == nil {
+			order.PaymentIntentId = paymentIntentId
+			database.DB.Model(&models.Order{}).Where("id = ?", order.Id).Update("payment_intent_id", paymentIntentId)
+			return order, nil
+		}
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return order, err
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return order, err
+	}
+
+	return order, gorm.ErrRecordNotFound
+}
+
+func toCents(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
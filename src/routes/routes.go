@@ -18,13 +18,57 @@ func Setup(app *fiber.App) {
 	adminAuthenticated.Put("users/info", controllers.UpdateInfo)
 	adminAuthenticated.Put("users/password", controllers.UpdatePassword)
 	adminAuthenticated.Get("ambassadors", controllers.Ambassadors)
+	adminAuthenticated.Get("ambassadors/export", controllers.ExportAmbassadors)
 	adminAuthenticated.Get("products", controllers.Products)
 	adminAuthenticated.Post("products", controllers.CreateProduct)
 	adminAuthenticated.Get("products/:id", controllers.GetProduct)
 	adminAuthenticated.Put("products/:id", controllers.UpdateProduct)
 	adminAuthenticated.Delete("products/:id", controllers.DeleteProduct)
+	adminAuthenticated.Put("products/:id/prices/:currency", controllers.SetProductPrice)
+	adminAuthenticated.Delete("products/:id/prices/:currency", controllers.DeleteProductPrice)
 	adminAuthenticated.Get("users/:id/links", controllers.Link)
+	adminAuthenticated.Get("coupons", controllers.Coupons)
+	adminAuthenticated.Post("coupons", controllers.CreateCoupon)
+	adminAuthenticated.Get("coupons/:id", controllers.GetCoupon)
+	adminAuthenticated.Put("coupons/:id", controllers.UpdateCoupon)
+	adminAuthenticated.Delete("coupons/:id", controllers.DeleteCoupon)
+	adminAuthenticated.Get("tax-rates", controllers.TaxRates)
+	adminAuthenticated.Post("tax-rates", controllers.CreateTaxRate)
+	adminAuthenticated.Delete("tax-rates/:id", controllers.DeleteTaxRate)
+	adminAuthenticated.Get("exchange-rates", controllers.ExchangeRates)
+	adminAuthenticated.Put("exchange-rates/:currency", controllers.SetExchangeRate)
+	adminAuthenticated.Delete("exchange-rates/:currency", controllers.DeleteExchangeRate)
+	adminAuthenticated.Get("shipping-rules", controllers.ShippingRules)
+	adminAuthenticated.Post("shipping-rules", controllers.CreateShippingRule)
+	adminAuthenticated.Delete("shipping-rules/:id", controllers.DeleteShippingRule)
 	adminAuthenticated.Get("orders", controllers.Orders)
+	adminAuthenticated.Get("orders/export", controllers.ExportOrders)
+	adminAuthenticated.Get("orders/:id", controllers.GetOrder)
+	adminAuthenticated.Get("orders/:id/invoice", controllers.OrderInvoice)
+	adminAuthenticated.Post("orders/:id/cancel", controllers.CancelOrder)
+	adminAuthenticated.Post("orders/:id/refunds", controllers.RefundOrder)
+	adminAuthenticated.Get("orders/:id/refunds", controllers.OrderRefunds)
+	adminAuthenticated.Get("payouts", controllers.Payouts)
+	adminAuthenticated.Post("payouts", controllers.RecordPayout)
+	adminAuthenticated.Get("analytics", controllers.AdminAnalytics)
+	adminAuthenticated.Get("events", controllers.AdminEvents)
+	adminAuthenticated.Post("exports", controllers.CreateExport)
+	adminAuthenticated.Get("exports/:id", controllers.GetExport)
+	adminAuthenticated.Get("exports/:id/download", controllers.DownloadExport)
+	adminAuthenticated.Get("outbox", controllers.OutboxEvents)
+	adminAuthenticated.Post("outbox/replay", controllers.ReplayDeadOutboxEvents)
+	adminAuthenticated.Get("outbox/:id", controllers.GetOutboxEvent)
+	adminAuthenticated.Post("outbox/:id/replay", controllers.ReplayOutboxEvent)
+	adminAuthenticated.Get("webhooks/events", controllers.WebhookEvents)
+	adminAuthenticated.Get("webhooks", controllers.WebhookEndpoints)
+	adminAuthenticated.Post("webhooks", controllers.CreateWebhookEndpoint)
+	adminAuthenticated.Get("webhooks/:id", controllers.GetWebhookEndpoint)
+	adminAuthenticated.Put("webhooks/:id", controllers.UpdateWebhookEndpoint)
+	adminAuthenticated.Delete("webhooks/:id", controllers.DeleteWebhookEndpoint)
+	adminAuthenticated.Post("webhooks/:id/secret", controllers.RotateWebhookSecret)
+	adminAuthenticated.Get("webhooks/:id/deliveries", controllers.WebhookDeliveries)
+	adminAuthenticated.Get("webhooks/:id/deliveries/:delivery", controllers.GetWebhookDelivery)
+	adminAuthenticated.Post("webhooks/:id/deliveries/:delivery/redeliver", controllers.RedeliverWebhook)
 
 	ambassador := api.Group("ambassador")
 	ambassador.Post("register", controllers.Register)
@@ -38,11 +82,46 @@ func Setup(app *fiber.App) {
 	ambassadorAuthenticated.Put("users/info", controllers.UpdateInfo)
 	ambassadorAuthenticated.Put("users/password", controllers.UpdatePassword)
 	ambassadorAuthenticated.Post("links", controllers.CreateLink)
+	ambassadorAuthenticated.Get("links/available", controllers.CheckLinkCode)
+	ambassadorAuthenticated.Get("links", controllers.AmbassadorLinks)
+	ambassadorAuthenticated.Get("links/:id", controllers.AmbassadorLink)
+	ambassadorAuthenticated.Put("links/:id", controllers.UpdateLink)
+	ambassadorAuthenticated.Post("links/:id/pause", controllers.PauseLink)
+	ambassadorAuthenticated.Post("links/:id/resume", controllers.ResumeLink)
+	ambassadorAuthenticated.Delete("links/:id", controllers.DeleteLink)
+	ambassadorAuthenticated.Get("links/:id/qr", controllers.LinkQRCode)
 	ambassadorAuthenticated.Get("stats", controllers.Stats)
 	ambassadorAuthenticated.Get("rankings", controllers.Rankings)
+	ambassadorAuthenticated.Get("rankings/me", controllers.MyRanking)
+	ambassadorAuthenticated.Get("payouts", controllers.AmbassadorPayouts)
+	ambassadorAuthenticated.Get("analytics", controllers.AmbassadorAnalytics)
+	ambassadorAuthenticated.Get("events", controllers.AmbassadorEvents)
+	ambassadorAuthenticated.Get("notifications", controllers.Notifications)
+	ambassadorAuthenticated.Post("notifications/read-all", controllers.ReadAllNotifications)
+	ambassadorAuthenticated.Get("notifications/preferences", controllers.NotificationPreferences)
+	ambassadorAuthenticated.Put("notifications/preferences", controllers.UpdateNotificationPreferences)
+	ambassadorAuthenticated.Post("notifications/:id/read", controllers.ReadNotification)
+	ambassadorAuthenticated.Get("webhooks/events", controllers.WebhookEvents)
+	ambassadorAuthenticated.Get("webhooks", controllers.WebhookEndpoints)
+	ambassadorAuthenticated.Post("webhooks", controllers.CreateWebhookEndpoint)
+	ambassadorAuthenticated.Get("webhooks/:id", controllers.GetWebhookEndpoint)
+	ambassadorAuthenticated.Put("webhooks/:id", controllers.UpdateWebhookEndpoint)
+	ambassadorAuthenticated.Delete("webhooks/:id", controllers.DeleteWebhookEndpoint)
+	ambassadorAuthenticated.Post("webhooks/:id/secret", controllers.RotateWebhookSecret)
+	ambassadorAuthenticated.Get("webhooks/:id/deliveries", controllers.WebhookDeliveries)
+	ambassadorAuthenticated.Get("webhooks/:id/deliveries/:delivery", controllers.GetWebhookDelivery)
+	ambassadorAuthenticated.Post("webhooks/:id/deliveries/:delivery/redeliver", controllers.RedeliverWebhook)
 
 	checkout := api.Group("checkout")
 	checkout.Get("links/:code", controllers.GetLink)
-	checkout.Post("orders", controllers.CreateOrder)
-	checkout.Post("orders/confirm", controllers.CompleteOrder)
+	checkout.Post("orders", middlewares.Idempotency, controllers.CreateOrder)
+	checkout.Post("orders/confirm", middlewares.Idempotency, controllers.CompleteOrder)
+	checkout.Get("orders/resume/:token", controllers.ResumeCheckout)
+	checkout.Post("orders/lookup", controllers.LookupOrder)
+	checkout.Post("orders/access", controllers.OpenOrderLink)
+	checkout.Get("orders/view", controllers.ViewOrder)
+	checkout.Get("orders/:id/invoice", controllers.CustomerInvoice)
+
+	webhooks := api.Group("webhooks")
+	webhooks.Post("stripe", controllers.StripeWebhook)
 }
@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Poller runs queued work in the background, every poll interval and
+// whenever it is woken, e.g. right after new work was committed. Unlike a
+// Job it runs on every API instance; rows are shared out with Claim.
+type Poller struct {
+	name        string
+	intervalEnv string
+	interval    time.Duration
+	run         func(ctx context.Context) error
+
+	stop context.CancelFunc
+	done sync.WaitGroup
+	wake chan struct{}
+}
+
+// NewPoller returns a poller running run every intervalEnv, or every
+// interval when the variable is unset or invalid.
+func NewPoller(name string, intervalEnv string, interval time.Duration, run func(ctx context.Context) error) *Poller {
+	return &Poller{
+		name:        name,
+		intervalEnv: intervalEnv,
+		interval:    interval,
+		run:         run,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Start starts polling.
+func (p *Poller) Start() {
+	interval, err := time.ParseDuration(os.Getenv(p.intervalEnv))
+	if err != nil || interval <= 0 {
+		interval = p.interval
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p.stop = cancel
+
+	p.done.Add(1)
+	go func() {
+		defer p.done.Done()
+
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			case <-p.wake:
+			}
+
+			if err := p.run(ctx); err != nil && ctx.Err() == nil {
+				log.Printf("%s failed: %v", p.name, err)
+			}
+		}
+	}()
+
+	log.Printf("%s polling every %s", p.name, interval)
+}
+
+// Stop stops polling and waits for the run in progress.
+func (p *Poller) Stop() {
+	if p.stop != nil {
+		p.stop()
+		p.done.Wait()
+	}
+}
+
+// Wake asks the poller to run now.
+func (p *Poller) Wake() {
+	select {
+	case p.wake <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,38 @@
+package scheduler
+
+import (
+	"ambassador/src/database"
+	"gorm.io/gorm"
+	"time"
+)
+
+// Claim leases the pending row with the given id in the table of model to
+// the caller and counts the attempt. The row is hidden from other pollers
+// until the lease runs out, so it is picked up again if the caller crashes.
+// It returns false when the row was claimed first or is no longer due.
+func Claim(model interface{}, id uint, pending string, lease time.Duration) (bool, error) {
+	now := time.Now()
+	result := database.DB.Model(model).
+		Where("id = ? AND status = ? AND next_attempt_at <= ?", id, pending, now).
+		Updates(map[string]interface{}{
+			"attempts":        gorm.Expr("attempts + 1"),
+			"next_attempt_at": now.Add(lease),
+		})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected == 1, nil
+}
+
+// Backoff returns the delay before the next attempt, starting at base and
+// doubling with every failed attempt up to max.
+func Backoff(attempts int, base time.Duration, max time.Duration) time.Duration {
+	delay := base
+	for i := 1; i < attempts && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	return delay
+}
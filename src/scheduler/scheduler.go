@@ -0,0 +1,84 @@
+package scheduler
+
+import (
+	"ambassador/src/database"
+	"context"
+	"log"
+	"os"
+	"sync"
+	"time"
+)
+
+// Job is periodic background work. Every API instance schedules it, but a
+// Redis lock makes sure only one of them runs it at a time.
+type Job struct {
+	Name        string // used in log lines, e.g. "Checkout expiry"
+	IntervalEnv string // variable holding the interval, e.g. "15m"
+	LockKey     string
+	Run         func(ctx context.Context) error
+}
+
+var (
+	stop    context.CancelFunc
+	running sync.WaitGroup
+)
+
+// Start schedules every job whose interval is configured. Jobs with an unset
+// or invalid interval are disabled.
+func Start(jobs ...Job) {
+	ctx, cancel := context.WithCancel(context.Background())
+	stop = cancel
+
+	for _, job := range jobs {
+		interval, err := time.ParseDuration(os.Getenv(job.IntervalEnv))
+		if err != nil || interval <= 0 {
+			log.Printf("%s scheduler disabled", job.Name)
+			continue
+		}
+
+		running.Add(1)
+		go func(job Job) {
+			defer running.Done()
+
+			ticker := time.NewTicker(interval)
+			defer ticker.Stop()
+
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					runWithLock(ctx, job, interval)
+				}
+			}
+		}(job)
+
+		log.Printf("%s scheduled every %s", job.Name, interval)
+	}
+}
+
+// Stop stops every job and waits for running ones to finish.
+func Stop() {
+	if stop != nil {
+		stop()
+		running.Wait()
+	}
+}
+
+// runWithLock runs the job unless another instance is running it. The lock
+// expires after one interval so a crashed instance does not hold it forever.
+func runWithLock(ctx context.Context, job Job, interval time.Duration) {
+	lock, err := database.AcquireLock(ctx, job.LockKey, interval)
+	if err != nil {
+		log.Printf("Failed to acquire %s lock: %v", job.Name, err)
+		return
+	}
+	if lock == nil {
+		return
+	}
+	defer lock.Release()
+
+	if err := job.Run(ctx); err != nil {
+		log.Printf("%s failed: %v", job.Name, err)
+	}
+}
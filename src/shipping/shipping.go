@@ -0,0 +1,53 @@
+package shipping
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"math"
+	"strings"
+)
+
+// Calculator prices shipping for a cart.
+type Calculator interface {
+	Calculate(country string, subtotal float64, weight float64) (float64, error)
+}
+
+// Default is the calculator used at checkout.
+var Default Calculator = RuleCalculator{}
+
+// RuleCalculator applies the shipping rule of the destination country, falling
+// back to the catch-all rule. Without any matching rule shipping is free.
+type RuleCalculator struct{}
+
+func (RuleCalculator) Calculate(country string, subtotal float64, weight float64) (float64, error) {
+	var rules []models.ShippingRule
+	if err := database.DB.Where("country IN ?", []string{strings.ToUpper(country), ""}).Find(&rules).Error; err != nil {
+		return 0, err
+	}
+
+	var rule *models.ShippingRule
+	for i := range rules {
+		if rule == nil || rules[i].Country != "" {
+			rule = &rules[i]
+		}
+	}
+	if rule == nil {
+		return 0, nil
+	}
+
+	return Price(*rule, subtotal, weight), nil
+}
+
+// Price computes the shipping cost of a cart under a rule.
+func Price(rule models.ShippingRule, subtotal float64, weight float64) float64 {
+	if rule.FreeOver > 0 && subtotal >= rule.FreeOver {
+		return 0
+	}
+
+	amount := rule.Amount
+	if rule.Type == models.ShippingWeight {
+		amount += rule.PerKg * weight
+	}
+
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,84 @@
+package tax
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"math"
+	"strings"
+)
+
+// Result is the tax computed for a cart.
+type Result struct {
+	Rate      float64
+	Inclusive bool      // the tax is already part of the line amounts
+	Lines     []float64 // tax per line, rounded to cents
+	Total     float64
+}
+
+// Calculator computes the tax owed on cart lines shipped to an address.
+type Calculator interface {
+	Calculate(country string, region string, amounts []float64) (Result, error)
+}
+
+// Default is the calculator used at checkout.
+var Default Calculator = TableCalculator{}
+
+// TableCalculator looks rates up in the tax_rates table, preferring a
+// region-specific rate over the country-wide one. Countries without a rate
+// are not taxed.
+type TableCalculator struct{}
+
+func (TableCalculator) Calculate(country string, region string, amounts []float64) (Result, error) {
+	rate, err := lookup(strings.ToUpper(country), region)
+	if err != nil {
+		return Result{}, err
+	}
+
+	return Apply(rate, amounts), nil
+}
+
+// Apply computes the tax of each amount at the given rate.
+func Apply(rate models.TaxRate, amounts []float64) Result {
+	result := Result{
+		Rate:      rate.Rate,
+		Inclusive: rate.Inclusive,
+		Lines:     make([]float64, len(amounts)),
+	}
+
+	for i, amount := range amounts {
+		if rate.Inclusive {
+			// Extract the tax already contained in the amount
+			result.Lines[i] = roundCents(amount - amount/(1+rate.Rate))
+		} else {
+			result.Lines[i] = roundCents(amount * rate.Rate)
+		}
+		result.Total += result.Lines[i]
+	}
+	result.Total = roundCents(result.Total)
+
+	return result
+}
+
+func lookup(country string, region string) (models.TaxRate, error) {
+	var rates []models.TaxRate
+	err := database.DB.Where("country = ? AND region IN ?", country, []string{region, ""}).Find(&rates).Error
+	if err != nil {
+		return models.TaxRate{}, err
+	}
+
+	var found *models.TaxRate
+	for i := range rates {
+		if found == nil || strings.EqualFold(rates[i].Region, region) && rates[i].Region != "" {
+			found = &rates[i]
+		}
+	}
+	if found == nil {
+		return models.TaxRate{}, nil
+	}
+
+	return *found, nil
+}
+
+func roundCents(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
@@ -0,0 +1,327 @@
+package webhooks
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"ambassador/src/scheduler"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"syscall"
+	"time"
+)
+
+const (
+	batchSize = 50
+
+	// MaxAttempts is how often a delivery is tried before it is marked failed.
+	MaxAttempts = 8
+	// DisableAfter is how many failed attempts in a row disable an endpoint.
+	DisableAfter = 20
+
+	lease          = 2 * time.Minute
+	requestTimeout = 10 * time.Second
+	baseBackoff    = 30 * time.Second
+	maxBackoff     = 6 * time.Hour
+	maxBodyLog     = 1024
+)
+
+var (
+	ErrEndpointDisabled = errors.New("endpoint is disabled")
+	errPrivateAddress   = errors.New("webhook URL resolves to a private address")
+)
+
+// Report summarises one dispatch run.
+type Report struct {
+	Succeeded int `json:"succeeded"`
+	Retried   int `json:"retried"`
+	Failed    int `json:"failed"`
+	Disabled  int `json:"disabled"`
+}
+
+var client = &http.Client{
+	Timeout: requestTimeout,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{Timeout: requestTimeout, Control: guardAddress}).DialContext,
+	},
+	// Redirects are not followed, the endpoint must answer itself
+	CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	},
+}
+
+// guardAddress refuses connections to loopback, private and link-local
+// addresses unless WEBHOOK_ALLOW_PRIVATE_URLS=true, so endpoints cannot be
+// used to reach internal services.
+func guardAddress(network, address string, _ syscall.RawConn) error {
+	if os.Getenv("WEBHOOK_ALLOW_PRIVATE_URLS") == "true" {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsUnspecified() {
+		return errPrivateAddress
+	}
+	return nil
+}
+
+// Dispatch sends every delivery that is due, oldest first, until none are
+// left or the context is cancelled.
+func Dispatch(ctx context.Context) (Report, error) {
+	var report Report
+	lastId := uint(0)
+
+	for {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+
+		var deliveries []models.WebhookDelivery
+		err := database.DB.
+			Where("status = ? AND next_attempt_at <= ? AND id > ?", models.WebhookPending, time.Now(), lastId).
+			Order("id").
+			Limit(batchSize).
+			Find(&deliveries).Error
+		if err != nil {
+			return report, err
+		}
+		if len(deliveries) == 0 {
+			return report, nil
+		}
+
+		for i := range deliveries {
+			delivery := &deliveries[i]
+			lastId = delivery.Id
+
+			claimed, err := claim(delivery)
+			if err != nil {
+				return report, err
+			}
+			if !claimed {
+				continue
+			}
+
+			disabled, err := attempt(ctx, delivery)
+			if err != nil {
+				log.Printf("Failed to update webhook delivery %d: %v", delivery.Id, err)
+				continue
+			}
+			if disabled {
+				report.Disabled++
+			}
+
+			switch delivery.Status {
+			case models.WebhookSucceeded:
+				report.Succeeded++
+			case models.WebhookFailed:
+				report.Failed++
+			default:
+				report.Retried++
+			}
+		}
+	}
+}
+
+// claim leases a delivery to this dispatcher and counts the attempt.
+func claim(delivery *models.WebhookDelivery) (bool, error) {
+	claimed, err := scheduler.Claim(&models.WebhookDelivery{}, delivery.Id, models.WebhookPending, lease)
+	if err != nil {
+		return false, err
+	}
+
+	delivery.Attempts++
+	return claimed, nil
+}
+
+// attempt sends a delivery once, logs the attempt and schedules a retry or
+// gives up. It reports whether the endpoint was disabled as a result.
+func attempt(ctx context.Context, delivery *models.WebhookDelivery) (bool, error) {
+	var endpoint models.WebhookEndpoint
+	if err := database.DB.First(&endpoint, delivery.EndpointId).Error; err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, err
+		}
+		return false, finish(delivery, models.WebhookFailed, 0, "endpoint was deleted")
+	}
+	if !endpoint.Active {
+		return false, finish(delivery, models.WebhookFailed, 0, ErrEndpointDisabled.Error())
+	}
+
+	// Send the request and log the attempt
+	started := time.Now()
+	status, body, sendErr := send(ctx, endpoint, delivery)
+
+	entry := models.WebhookAttempt{
+		DeliveryId:     delivery.Id,
+		ResponseStatus: status,
+		ResponseBody:   body,
+		DurationMs:     time.Since(started).Milliseconds(),
+	}
+	if sendErr != nil {
+		entry.Error = sendErr.Error()
+	}
+	if err := database.DB.Create(&entry).Error; err != nil {
+		return false, err
+	}
+
+	if sendErr == nil {
+		if err := database.DB.Model(&endpoint).Update("consecutive_failures", 0).Error; err != nil {
+			return false, err
+		}
+		return false, finish(delivery, models.WebhookSucceeded, status, "")
+	}
+
+	// Count the failure against the endpoint and disable it past the limit
+	disabled, err := recordFailure(&endpoint)
+	if err != nil {
+		return false, err
+	}
+
+	delay, retried := retry(delivery.Attempts, disabled)
+	if !retried {
+		return disabled, finish(delivery, models.WebhookFailed, status, sendErr.Error())
+	}
+
+	delivery.NextAttemptAt = time.Now().Add(delay)
+	delivery.ResponseStatus = status
+	delivery.LastError = sendErr.Error()
+	return false, database.DB.Model(delivery).Updates(map[string]interface{}{
+		"next_attempt_at": delivery.NextAttemptAt,
+		"response_status": status,
+		"last_error":      delivery.LastError,
+	}).Error
+}
+
+// send posts the payload with its signature. Any response other than 2xx is
+// an error.
+func send(ctx context.Context, endpoint models.WebhookEndpoint, delivery *models.WebhookDelivery) (int, string, error) {
+	body := []byte(delivery.Payload)
+
+	request, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, "", err
+	}
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("User-Agent", "Ambassador-Webhooks/1.0")
+	request.Header.Set("X-Webhook-Event", delivery.EventType)
+	request.Header.Set("X-Webhook-Id", delivery.EventId)
+	request.Header.Set("X-Webhook-Delivery", fmt.Sprint(delivery.Id))
+	request.Header.Set("X-Webhook-Signature", Signature(endpoint.Secret, time.Now(), body))
+
+	response, err := client.Do(request)
+	if err != nil {
+		return 0, "", err
+	}
+	defer response.Body.Close()
+
+	excerpt, _ := io.ReadAll(io.LimitReader(response.Body, maxBodyLog))
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return response.StatusCode, string(excerpt), fmt.Errorf("endpoint responded with status %d", response.StatusCode)
+	}
+	return response.StatusCode, string(excerpt), nil
+}
+
+// finish records the final outcome of a delivery.
+func finish(delivery *models.WebhookDelivery, status string, responseStatus int, lastError string) error {
+	updates := map[string]interface{}{
+		"status":          status,
+		"response_status": responseStatus,
+		"last_error":      lastError,
+	}
+	if status == models.WebhookSucceeded {
+		now := time.Now()
+		updates["delivered_at"] = now
+		delivery.DeliveredAt = &now
+	}
+
+	delivery.Status = status
+	delivery.ResponseStatus = responseStatus
+	delivery.LastError = lastError
+	return database.DB.Model(delivery).Updates(updates).Error
+}
+
+// recordFailure counts a failed attempt against the endpoint and disables it
+// once DisableAfter attempts in a row have failed.
+func recordFailure(endpoint *models.WebhookEndpoint) (bool, error) {
+	err := database.DB.Model(endpoint).Update("consecutive_failures", gorm.Expr("consecutive_failures + 1")).Error
+	if err != nil {
+		return false, err
+	}
+	endpoint.ConsecutiveFailures++
+
+	if !disables(endpoint.ConsecutiveFailures) {
+		return false, nil
+	}
+
+	now := time.Now()
+	reason := fmt.Sprintf("Disabled after %d failed deliveries in a row", endpoint.ConsecutiveFailures)
+	result := database.DB.Model(&models.WebhookEndpoint{}).
+		Where("id = ? AND active = ?", endpoint.Id, true).
+		Updates(map[string]interface{}{"active": false, "disabled_at": now, "disabled_reason": reason})
+	if result.Error != nil {
+		return false, result.Error
+	}
+	if result.RowsAffected == 1 {
+		log.Printf("Webhook endpoint %d disabled after %d failed deliveries", endpoint.Id, endpoint.ConsecutiveFailures)
+	}
+
+	return result.RowsAffected == 1, nil
+}
+
+// retry reports whether a failed delivery is tried again and after how long.
+// It is not once the delivery ran out of attempts or its endpoint was disabled.
+func retry(attempts int, endpointDisabled bool) (time.Duration, bool) {
+	if endpointDisabled || attempts >= MaxAttempts {
+		return 0, false
+	}
+	return Backoff(attempts), true
+}
+
+// disables reports whether an endpoint is disabled after the given number of
+// failed attempts in a row.
+func disables(consecutiveFailures int) bool {
+	return consecutiveFailures >= DisableAfter
+}
+
+// Backoff returns the delay before the next attempt, doubling with every
+// failed attempt up to six hours.
+func Backoff(attempts int) time.Duration {
+	return scheduler.Backoff(attempts, baseBackoff, maxBackoff)
+}
+
+// Redeliver schedules a delivery to be sent again right away with a fresh
+// set of attempts, whatever its outcome was.
+func Redeliver(delivery *models.WebhookDelivery) error {
+	var endpoint models.WebhookEndpoint
+	if err := database.DB.First(&endpoint, delivery.EndpointId).Error; err != nil {
+		return err
+	}
+	if !endpoint.Active {
+		return ErrEndpointDisabled
+	}
+
+	delivery.Status = models.WebhookPending
+	delivery.Attempts = 0
+	delivery.NextAttemptAt = time.Now()
+
+	err := database.DB.Model(delivery).Updates(map[string]interface{}{
+		"status":          delivery.Status,
+		"attempts":        delivery.Attempts,
+		"next_attempt_at": delivery.NextAttemptAt,
+	}).Error
+	if err == nil {
+		Wake()
+	}
+	return err
+}
@@ -0,0 +1,331 @@
+package webhooks
+
+import (
+	"ambassador/src/database"
+	"ambassador/src/models"
+	"context"
+	"errors"
+	"github.com/google/uuid"
+	"gorm.io/driver/mysql"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+)
+
+// receiver is an endpoint answering with the given statuses in turn, then
+// with the last one, and recording the requests it got.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []*http.Request
+	bodies   [][]byte
+}
+
+func (r *receiver) ServeHTTP(w http.ResponseWriter, request *http.Request) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	body, _ := io.ReadAll(request.Body)
+	r.requests = append(r.requests, request)
+	r.bodies = append(r.bodies, body)
+
+	status := r.statuses[0]
+	if len(r.statuses) > 1 {
+		r.statuses = r.statuses[1:]
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, http.StatusText(status))
+}
+
+// received returns the requests so far and their bodies.
+func (r *receiver) received() ([]*http.Request, [][]byte) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.requests, r.bodies
+}
+
+// serve starts a receiver the client may connect to although it listens on
+// a loopback address.
+func serve(t *testing.T, statuses ...int) (*receiver, *httptest.Server) {
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_URLS", "true")
+
+	r := &receiver{statuses: statuses}
+	server := httptest.NewServer(r)
+	t.Cleanup(server.Close)
+	return r, server
+}
+
+func TestSend(t *testing.T) {
+	r, server := serve(t, http.StatusNoContent)
+	endpoint := models.WebhookEndpoint{URL: server.URL, Secret: "whsec_test"}
+	delivery := &models.WebhookDelivery{
+		Model:     models.Model{Id: 7},
+		EventId:   "evt_1",
+		EventType: EventOrderCompleted,
+		Payload:   `{"id":"evt_1","type":"order.completed"}`,
+	}
+
+	status, _, err := send(context.Background(), endpoint, delivery)
+	if err != nil || status != http.StatusNoContent {
+		t.Fatalf("send = %d, %v, want 204 without an error", status, err)
+	}
+
+	requests, bodies := r.received()
+	request := requests[0]
+	if string(bodies[0]) != delivery.Payload {
+		t.Errorf("body = %s, want the payload", bodies[0])
+	}
+	for header, want := range map[string]string{
+		"Content-Type":       "application/json",
+		"X-Webhook-Event":    EventOrderCompleted,
+		"X-Webhook-Id":       "evt_1",
+		"X-Webhook-Delivery": "7",
+	} {
+		if got := request.Header.Get(header); got != want {
+			t.Errorf("%s = %q, want %q", header, got, want)
+		}
+	}
+
+	signed := verify(t, endpoint.Secret, request.Header.Get("X-Webhook-Signature"), bodies[0])
+	if time.Since(signed) > time.Minute {
+		t.Errorf("signed at %v, want the time of sending", signed)
+	}
+}
+
+func TestSendFailure(t *testing.T) {
+	_, server := serve(t, http.StatusInternalServerError)
+	endpoint := models.WebhookEndpoint{URL: server.URL, Secret: "whsec_test"}
+
+	status, body, err := send(context.Background(), endpoint, &models.WebhookDelivery{Payload: `{}`})
+	if err == nil || status != http.StatusInternalServerError {
+		t.Fatalf("send = %d, %v, want 500 with an error", status, err)
+	}
+	if body != http.StatusText(http.StatusInternalServerError) {
+		t.Errorf("body = %q, want the response body for the attempt log", body)
+	}
+}
+
+func TestSendRejectsPrivateAddresses(t *testing.T) {
+	r, server := serve(t, http.StatusOK)
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_URLS", "")
+	endpoint := models.WebhookEndpoint{URL: server.URL, Secret: "whsec_test"}
+
+	_, _, err := send(context.Background(), endpoint, &models.WebhookDelivery{Payload: `{}`})
+	if !errors.Is(err, errPrivateAddress) {
+		t.Fatalf("send error = %v, want errPrivateAddress", err)
+	}
+	if requests, _ := r.received(); len(requests) != 0 {
+		t.Error("the private address was requested")
+	}
+}
+
+func TestGuardAddress(t *testing.T) {
+	for address, allowed := range map[string]bool{
+		"93.184.216.34:443":   true,
+		"[2606:4700::1]:443":  true,
+		"127.0.0.1:80":        false,
+		"10.1.2.3:80":         false,
+		"172.16.0.1:80":       false,
+		"192.168.1.1:80":      false,
+		"169.254.169.254:80":  false,
+		"0.0.0.0:80":          false,
+		"[::1]:80":            false,
+		"[fe80::1]:80":        false,
+		"[fd00::1]:80":        false,
+		"internal.example:80": false,
+	} {
+		err := guardAddress("tcp", address, nil)
+		if (err == nil) != allowed {
+			t.Errorf("guardAddress(%q) = %v, want allowed %t", address, err, allowed)
+		}
+	}
+
+	t.Setenv("WEBHOOK_ALLOW_PRIVATE_URLS", "true")
+	if err := guardAddress("tcp", "127.0.0.1:80", nil); err != nil {
+		t.Errorf("guardAddress with private URLs allowed = %v", err)
+	}
+}
+
+func TestRetry(t *testing.T) {
+	for attempts, want := range map[int]time.Duration{
+		1: 30 * time.Second,
+		2: time.Minute,
+		4: 4 * time.Minute,
+		7: 32 * time.Minute,
+	} {
+		delay, retried := retry(attempts, false)
+		if !retried || delay != want {
+			t.Errorf("retry(%d) = %s, %t, want %s", attempts, delay, retried, want)
+		}
+	}
+
+	if _, retried := retry(MaxAttempts, false); retried {
+		t.Error("a delivery out of attempts is retried")
+	}
+	if _, retried := retry(1, true); retried {
+		t.Error("a delivery to a disabled endpoint is retried")
+	}
+	if delay := Backoff(30); delay != maxBackoff {
+		t.Errorf("Backoff(30) = %s, want it capped at %s", delay, maxBackoff)
+	}
+}
+
+func TestDisables(t *testing.T) {
+	if disables(DisableAfter - 1) {
+		t.Errorf("endpoint disabled after %d failures", DisableAfter-1)
+	}
+	if !disables(DisableAfter) {
+		t.Errorf("endpoint not disabled after %d failures", DisableAfter)
+	}
+}
+
+// useTestDatabase points the database package at the MySQL database in
+// TEST_DATABASE_DSN, e.g. "root:root@tcp(localhost:3306)/ambassador_test?parseTime=True&loc=Local",
+// skipping the test when it is not set.
+func useTestDatabase(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_DSN")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_DSN is not set")
+	}
+
+	db, err := gorm.Open(mysql.Open(dsn), &gorm.Config{TranslateError: true})
+	if err != nil {
+		t.Fatalf("Failed to connect to the test database: %v", err)
+	}
+	if err := db.AutoMigrate(models.WebhookEndpoint{}, models.WebhookDelivery{}, models.WebhookAttempt{}); err != nil {
+		t.Fatalf("Failed to migrate the test database: %v", err)
+	}
+
+	previous := database.DB
+	database.DB = db
+	t.Cleanup(func() { database.DB = previous })
+}
+
+// createDelivery stores an endpoint at url and a delivery due to it.
+func createDelivery(t *testing.T, url string, consecutiveFailures int) (models.WebhookEndpoint, models.WebhookDelivery) {
+	endpoint := models.WebhookEndpoint{
+		URL:                 url,
+		Events:              EventOrderCompleted,
+		Secret:              "whsec_test",
+		Active:              true,
+		ConsecutiveFailures: consecutiveFailures,
+	}
+	if err := database.DB.Create(&endpoint).Error; err != nil {
+		t.Fatalf("Failed to create endpoint: %v", err)
+	}
+
+	delivery := models.WebhookDelivery{
+		EndpointId:    endpoint.Id,
+		EventId:       uuid.NewString(),
+		EventType:     EventOrderCompleted,
+		Payload:       `{"type":"order.completed"}`,
+		Status:        models.WebhookPending,
+		NextAttemptAt: time.Now().Add(-time.Second),
+	}
+	if err := database.DB.Create(&delivery).Error; err != nil {
+		t.Fatalf("Failed to create delivery: %v", err)
+	}
+
+	t.Cleanup(func() {
+		database.DB.Where("delivery_id = ?", delivery.Id).Delete(&models.WebhookAttempt{})
+		database.DB.Delete(&delivery)
+		database.DB.Delete(&endpoint)
+	})
+	return endpoint, delivery
+}
+
+func attempts(t *testing.T, delivery models.WebhookDelivery) []models.WebhookAttempt {
+	var log []models.WebhookAttempt
+	if err := database.DB.Where("delivery_id = ?", delivery.Id).Order("id").Find(&log).Error; err != nil {
+		t.Fatalf("Failed to fetch attempts: %v", err)
+	}
+	return log
+}
+
+func TestDispatchRetriesWithBackoff(t *testing.T) {
+	useTestDatabase(t)
+	r, server := serve(t, http.StatusBadGateway, http.StatusOK)
+	endpoint, delivery := createDelivery(t, server.URL, 0)
+
+	// The first attempt fails and is scheduled again
+	started := time.Now()
+	if _, err := Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+
+	database.DB.First(&delivery, delivery.Id)
+	if delivery.Status != models.WebhookPending || delivery.Attempts != 1 {
+		t.Fatalf("delivery is %s after %d attempts, want pending after 1", delivery.Status, delivery.Attempts)
+	}
+	if wait := delivery.NextAttemptAt.Sub(started); wait < Backoff(1)-time.Second || wait > Backoff(1)+5*time.Second {
+		t.Errorf("next attempt in %s, want %s", wait, Backoff(1))
+	}
+
+	log := attempts(t, delivery)
+	if len(log) != 1 || log[0].ResponseStatus != http.StatusBadGateway || log[0].Error == "" {
+		t.Fatalf("attempt log = %+v, want one failed 502 attempt", log)
+	}
+	if log[0].ResponseBody != http.StatusText(http.StatusBadGateway) {
+		t.Errorf("logged body = %q, want the response body", log[0].ResponseBody)
+	}
+
+	// It is not sent again before the backoff ran out
+	if _, err := Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if requests, _ := r.received(); len(requests) != 1 {
+		t.Fatalf("endpoint got %d requests before the backoff ran out, want 1", len(requests))
+	}
+
+	// The retry succeeds and resets the endpoint's failures
+	database.DB.Model(&delivery).Update("next_attempt_at", time.Now().Add(-time.Second))
+	if _, err := Dispatch(context.Background()); err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+
+	database.DB.First(&delivery, delivery.Id)
+	if delivery.Status != models.WebhookSucceeded || delivery.Attempts != 2 || delivery.DeliveredAt == nil {
+		t.Errorf("delivery = %+v, want succeeded after 2 attempts", delivery)
+	}
+	if log := attempts(t, delivery); len(log) != 2 || log[1].ResponseStatus != http.StatusOK || log[1].Error != "" {
+		t.Errorf("attempt log = %+v, want a successful second attempt", log)
+	}
+
+	database.DB.First(&endpoint, endpoint.Id)
+	if endpoint.ConsecutiveFailures != 0 {
+		t.Errorf("endpoint has %d consecutive failures, want 0", endpoint.ConsecutiveFailures)
+	}
+}
+
+func TestDispatchDisablesFailingEndpoint(t *testing.T) {
+	useTestDatabase(t)
+	_, server := serve(t, http.StatusServiceUnavailable)
+	endpoint, delivery := createDelivery(t, server.URL, DisableAfter-1)
+
+	report, err := Dispatch(context.Background())
+	if err != nil {
+		t.Fatalf("Dispatch: %v", err)
+	}
+	if report.Disabled != 1 {
+		t.Errorf("report = %+v, want one endpoint disabled", report)
+	}
+
+	database.DB.First(&endpoint, endpoint.Id)
+	if endpoint.Active || endpoint.DisabledAt == nil || endpoint.DisabledReason == "" {
+		t.Errorf("endpoint = %+v, want it disabled", endpoint)
+	}
+
+	// The delivery is not retried against the disabled endpoint
+	database.DB.First(&delivery, delivery.Id)
+	if delivery.Status != models.WebhookFailed || delivery.ResponseStatus != http.StatusServiceUnavailable {
+		t.Errorf("delivery = %+v, want failed with 503", delivery)
+	}
+	if log := attempts(t, delivery); len(log) != 1 {
+		t.Errorf("attempt log = %+v, want one attempt", log)
+	}
+}
@@ -0,0 +1,34 @@
+package webhooks
+
+import (
+	"ambassador/src/scheduler"
+	"context"
+	"log"
+	"time"
+)
+
+var dispatcher = scheduler.NewPoller("Webhook dispatcher", "WEBHOOK_POLL_INTERVAL", 5*time.Second, dispatch)
+
+// StartDispatcher sends webhook deliveries in the background, polling every
+// WEBHOOK_POLL_INTERVAL (default 5s) and whenever Wake is called.
+func StartDispatcher() {
+	dispatcher.Start()
+}
+
+// StopDispatcher stops the dispatcher and waits for the request in progress.
+func StopDispatcher() {
+	dispatcher.Stop()
+}
+
+// Wake asks the dispatcher to run now, e.g. right after events were published.
+func Wake() {
+	dispatcher.Wake()
+}
+
+func dispatch(ctx context.Context) error {
+	report, err := Dispatch(ctx)
+	if report.Retried > 0 || report.Failed > 0 || report.Disabled > 0 {
+		log.Printf("Webhook dispatch: %+v", report)
+	}
+	return err
+}
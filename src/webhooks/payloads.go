@@ -0,0 +1,144 @@
+package webhooks
+
+import (
+	"ambassador/src/models"
+	"time"
+)
+
+// Event data leaves out customer details: ambassadors only see what their
+// Stats already show them.
+
+type OrderItemData struct {
+	ProductId uint    `json:"product_id"`
+	Title     string  `json:"title"`
+	Quantity  uint    `json:"quantity"`
+	Price     float64 `json:"price"`
+}
+
+type OrderCompletedData struct {
+	OrderId           uint            `json:"order_id"`
+	Code              string          `json:"code"`
+	AmbassadorId      uint            `json:"ambassador_id"`
+	Currency          string          `json:"currency"`
+	Total             float64         `json:"total"`
+	AmbassadorRevenue float64         `json:"ambassador_revenue"`
+	CompletedAt       *time.Time      `json:"completed_at"`
+	Items             []OrderItemData `json:"items"`
+}
+
+type OrderRefundedData struct {
+	OrderId           uint      `json:"order_id"`
+	RefundId          uint      `json:"refund_id"`
+	Code              string    `json:"code"`
+	AmbassadorId      uint      `json:"ambassador_id"`
+	Status            string    `json:"status"`
+	Currency          string    `json:"currency"`
+	Amount            float64   `json:"amount"`
+	AmbassadorRevenue float64   `json:"ambassador_revenue_reversed"`
+	RefundedAt        time.Time `json:"refunded_at"`
+}
+
+type LinkCreatedData struct {
+	LinkId       uint       `json:"link_id"`
+	Code         string     `json:"code"`
+	AmbassadorId uint       `json:"ambassador_id"`
+	Currency     string     `json:"currency"`
+	ProductIds   []uint     `json:"product_ids"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+}
+
+type LinkExpiredData struct {
+	LinkId       uint       `json:"link_id"`
+	Code         string     `json:"code"`
+	AmbassadorId uint       `json:"ambassador_id"`
+	ExpiresAt    *time.Time `json:"expires_at"`
+}
+
+type PayoutPaidData struct {
+	PayoutId     uint      `json:"payout_id"`
+	AmbassadorId uint      `json:"ambassador_id"`
+	Currency     string    `json:"currency"`
+	Amount       float64   `json:"amount"`
+	Reference    string    `json:"reference"`
+	PaidAt       time.Time `json:"paid_at"`
+}
+
+// OrderCompleted describes a paid order loaded with its items.
+func OrderCompleted(order models.Order) OrderCompletedData {
+	data := OrderCompletedData{
+		OrderId:      order.Id,
+		Code:         order.Code,
+		AmbassadorId: order.UserId,
+		Currency:     order.Currency,
+		Total:        order.GetChargedTotal(),
+		CompletedAt:  order.CompletedAt,
+		Items:        make([]OrderItemData, 0, len(order.OrderItems)),
+	}
+
+	for _, item := range order.OrderItems {
+		data.AmbassadorRevenue += item.AmbassadorRevenue
+		data.Items = append(data.Items, OrderItemData{
+			ProductId: item.ProductId,
+			Title:     item.ProductTitle,
+			Quantity:  item.Quantity,
+			Price:     item.Price,
+		})
+	}
+
+	return data
+}
+
+// OrderRefunded describes a refund issued on an order.
+func OrderRefunded(order models.Order, refund models.Refund) OrderRefundedData {
+	return OrderRefundedData{
+		OrderId:           order.Id,
+		RefundId:          refund.Id,
+		Code:              order.Code,
+		AmbassadorId:      order.UserId,
+		Status:            order.Status,
+		Currency:          order.Currency,
+		Amount:            refund.Amount,
+		AmbassadorRevenue: refund.AmbassadorRevenue,
+		RefundedAt:        refund.CreatedAt,
+	}
+}
+
+// LinkCreated describes a new link loaded with its products.
+func LinkCreated(link models.Link) LinkCreatedData {
+	data := LinkCreatedData{
+		LinkId:       link.Id,
+		Code:         link.Code,
+		AmbassadorId: link.UserId,
+		Currency:     link.Currency,
+		ProductIds:   make([]uint, 0, len(link.Products)),
+		ExpiresAt:    link.ExpiresAt,
+	}
+
+	for _, product := range link.Products {
+		data.ProductIds = append(data.ProductIds, product.Id)
+	}
+
+	return data
+}
+
+// LinkExpired describes a link that passed its expiry date.
+func LinkExpired(link models.Link) LinkExpiredData {
+	return LinkExpiredData{
+		LinkId:       link.Id,
+		Code:         link.Code,
+		AmbassadorId: link.UserId,
+		ExpiresAt:    link.ExpiresAt,
+	}
+}
+
+// PayoutPaid describes commission paid out to an ambassador.
+func PayoutPaid(payout models.Payout) PayoutPaidData {
+	return PayoutPaidData{
+		PayoutId:     payout.Id,
+		AmbassadorId: payout.UserId,
+		Currency:     payout.Currency,
+		Amount:       payout.Amount,
+		Reference:    payout.Reference,
+		PaidAt:       payout.PaidAt,
+	}
+}
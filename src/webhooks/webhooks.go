@@ -0,0 +1,159 @@
+package webhooks
+
+import (
+	"ambassador/src/models"
+	"ambassador/src/notifications"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Event types endpoints can subscribe to.
+const (
+	EventOrderCompleted = "order.completed"
+	EventOrderRefunded  = "order.refunded"
+	EventLinkCreated    = "link.created"
+	EventLinkExpired    = "link.expired"
+	EventPayoutPaid     = "payout.paid"
+)
+
+// Events lists every event type an endpoint can subscribe to.
+var Events = []string{EventOrderCompleted, EventOrderRefunded, EventLinkCreated, EventLinkExpired, EventPayoutPaid}
+
+var (
+	ErrInvalidURL   = errors.New("webhook URL must be an absolute http or https URL")
+	ErrInvalidEvent = errors.New("unknown webhook event type")
+	ErrNoEvents     = errors.New("at least one event type is required")
+)
+
+// Envelope is the JSON body of every webhook request.
+type Envelope struct {
+	Id        string      `json:"id"`
+	Type      string      `json:"type"`
+	CreatedAt time.Time   `json:"created_at"`
+	Data      interface{} `json:"data"`
+}
+
+// ValidEvent reports whether an endpoint can subscribe to the event type.
+func ValidEvent(eventType string) bool {
+	for _, event := range Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// NormalizeEvents validates a list of event types and returns them in the
+// stored comma-separated form, without duplicates.
+func NormalizeEvents(events []string) (string, error) {
+	seen := make(map[string]bool, len(events))
+	normalized := make([]string, 0, len(events))
+
+	for _, event := range events {
+		event = strings.TrimSpace(event)
+		if !ValidEvent(event) {
+			return "", fmt.Errorf("%w: %s", ErrInvalidEvent, event)
+		}
+		if !seen[event] {
+			seen[event] = true
+			normalized = append(normalized, event)
+		}
+	}
+
+	if len(normalized) == 0 {
+		return "", ErrNoEvents
+	}
+	return strings.Join(normalized, ","), nil
+}
+
+// ValidateURL checks that a webhook URL can be requested. Whether its host
+// may resolve to a private address is checked when connecting.
+func ValidateURL(raw string) error {
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.User != nil {
+		return ErrInvalidURL
+	}
+	return nil
+}
+
+// NewSecret returns a random signing secret for an endpoint.
+func NewSecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(buf), nil
+}
+
+// Signature returns the value of the X-Webhook-Signature header: the
+// timestamp and an HMAC-SHA256 of "<timestamp>.<body>" keyed with the
+// endpoint's secret.
+func Signature(secret string, timestamp time.Time, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp.Unix())
+	mac.Write(body)
+	return fmt.Sprintf("t=%d,v1=%s", timestamp.Unix(), hex.EncodeToString(mac.Sum(nil)))
+}
+
+// Publish records a delivery of the event for every active endpoint that
+// subscribes to it and may see the ambassador's data. The ambassador's own
+// endpoints are skipped when they turned webhooks off for the event in their
+// notification preferences; partner endpoints always receive it. Pass the
+// transaction of the change the event describes so both are committed
+// together.
+func Publish(tx *gorm.DB, eventType string, userId uint, data interface{}) error {
+	allowed, err := notifications.Allows(tx, userId, eventType, notifications.ChannelWebhook)
+	if err != nil {
+		return err
+	}
+
+	query := tx.Where("active = ? AND user_id = 0", true)
+	if allowed {
+		query = tx.Where("active = ? AND (user_id = 0 OR user_id = ?)", true, userId)
+	}
+
+	var endpoints []models.WebhookEndpoint
+	if err := query.Find(&endpoints).Error; err != nil {
+		return err
+	}
+
+	deliveries := make([]models.WebhookDelivery, 0, len(endpoints))
+	envelope := Envelope{Id: uuid.NewString(), Type: eventType, CreatedAt: time.Now(), Data: data}
+	var payload []byte
+
+	for _, endpoint := range endpoints {
+		if !endpoint.Subscribes(eventType) {
+			continue
+		}
+
+		if payload == nil {
+			if payload, err = json.Marshal(envelope); err != nil {
+				return err
+			}
+		}
+
+		deliveries = append(deliveries, models.WebhookDelivery{
+			EndpointId:    endpoint.Id,
+			EventId:       envelope.Id,
+			EventType:     eventType,
+			Payload:       string(payload),
+			Status:        models.WebhookPending,
+			NextAttemptAt: time.Now(),
+		})
+	}
+
+	if len(deliveries) == 0 {
+		return nil
+	}
+	return tx.Create(&deliveries).Error
+}